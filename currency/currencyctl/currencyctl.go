@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	curr "github.com/vladimirvivien/go-networking/currency/lib"
+)
+
+// This program is an operator tool for the currency service
+// (see serverjson5).  It talks to the admin endpoint of the
+// server using JSON-encoded curr.AdminRequest values to export
+// the currency dataset or import one from a file.
+//
+// Export writes every currency in the store as JSON or CSV (the
+// column order of data.csv).  Import reads a JSON or CSV file
+// (detected by file extension), validates every entry locally,
+// then either merges the entries into the store or replaces the
+// store entirely.  Merges are sent in batches with progress
+// reported on stderr; a replace is sent as a single request so
+// that the store is never left half-replaced.  With -dry-run the
+// server reports what would change without applying it.
+//
+// Usage: currencyctl [options] <command> [command options]
+// options:
+//   -e admin endpoint or socket path, default localhost:4041
+//   -n network protocol name [tcp,unix], default tcp
+// commands:
+//   export [-o json|csv] [-f file]
+//   import -f file [-merge|-replace] [-dry-run] [-batch size]
+//   stats
+func main() {
+	var addr, network string
+	flag.StringVar(&addr, "e", "localhost:4041", "admin endpoint [ip addr or socket path]")
+	flag.StringVar(&network, "n", "tcp", "network protocol [tcp,unix]")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "export":
+		err = export(network, addr, args)
+	case "import":
+		err = importFile(network, addr, args)
+	case "stats":
+		err = stats(network, addr)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "currencyctl:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: currencyctl [options] <command> [command options]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  export [-o json|csv] [-f file]")
+	fmt.Fprintln(os.Stderr, "  import -f file [-merge|-replace] [-dry-run] [-batch size]")
+	fmt.Fprintln(os.Stderr, "  stats")
+	fmt.Fprintln(os.Stderr, "options:")
+	flag.PrintDefaults()
+}
+
+// export retrieves the dataset from the server and writes it
+// to a file or stdout.
+func export(network, addr string, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var format, path string
+	fs.StringVar(&format, "o", "json", "output format [json,csv]")
+	fs.StringVar(&path, "f", "", "output file, default stdout")
+	fs.Parse(args)
+
+	if format != "json" && format != "csv" {
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+
+	client, err := dial(network, addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	resp, err := client.send(curr.AdminRequest{Cmd: curr.AdminList})
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if format == "csv" {
+		err = curr.WriteCSV(out, resp.Currencies)
+	} else {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(resp.Currencies)
+	}
+	if err != nil {
+		return err
+	}
+	if path != "" {
+		fmt.Fprintf(os.Stderr, "exported %d currencies to %s\n", len(resp.Currencies), path)
+	}
+	return nil
+}
+
+// importFile loads, validates, and sends a dataset to the server.
+func importFile(network, addr string, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var path string
+	var merge, replace, dryRun bool
+	var batch int
+	fs.StringVar(&path, "f", "", "input file [.json,.csv]")
+	fs.BoolVar(&merge, "merge", false, "merge entries into the store (default)")
+	fs.BoolVar(&replace, "replace", false, "replace the store with the entries")
+	fs.BoolVar(&dryRun, "dry-run", false, "report changes without applying them")
+	fs.IntVar(&batch, "batch", 50, "number of entries sent per merge request")
+	fs.Parse(args)
+
+	if path == "" {
+		return fmt.Errorf("import: missing input file (-f)")
+	}
+	if merge && replace {
+		return fmt.Errorf("import: -merge and -replace are mutually exclusive")
+	}
+	if batch < 1 {
+		return fmt.Errorf("import: invalid batch size %d", batch)
+	}
+
+	table, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	if err := curr.ValidateTable(table); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "validated %d currencies from %s\n", len(table), path)
+
+	client, err := dial(network, addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	mode := "merge"
+	if dryRun {
+		mode = "dry-run merge"
+	}
+
+	// a replace must be applied atomically, send it in one request
+	if replace {
+		mode = "replace"
+		if dryRun {
+			mode = "dry-run replace"
+		}
+		fmt.Fprintf(os.Stderr, "%s: sending %d currencies\n", mode, len(table))
+		resp, err := client.send(curr.AdminRequest{
+			Cmd:        curr.AdminImport,
+			Currencies: table,
+			Replace:    true,
+			DryRun:     dryRun,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d added, %d updated, %d removed\n", mode, resp.Added, resp.Updated, resp.Removed)
+		return nil
+	}
+
+	var added, updated int
+	for start := 0; start < len(table); start += batch {
+		end := start + batch
+		if end > len(table) {
+			end = len(table)
+		}
+		resp, err := client.send(curr.AdminRequest{
+			Cmd:        curr.AdminImport,
+			Currencies: table[start:end],
+			DryRun:     dryRun,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: after %d of %d: %v", mode, start, len(table), err)
+		}
+		added += resp.Added
+		updated += resp.Updated
+		fmt.Fprintf(os.Stderr, "%s: %d/%d (%d%%)\n", mode, end, len(table), end*100/len(table))
+	}
+	fmt.Printf("%s: %d added, %d updated\n", mode, added, updated)
+	return nil
+}
+
+// stats prints the health and statistics reported by the server.
+func stats(network, addr string) error {
+	client, err := dial(network, addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	resp, err := client.send(curr.AdminRequest{Cmd: curr.AdminStats})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(resp.Stats)
+}
+
+// readFile decodes currencies from a JSON or CSV file
+// based on the file extension.
+func readFile(path string) ([]curr.Currency, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return curr.ReadCSV(bytes.NewReader(data))
+	case ".json":
+		var table []curr.Currency
+		if err := json.Unmarshal(data, &table); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return table, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown file type, expecting .json or .csv", path)
+	}
+}
+
+// adminClient is a connection to the admin endpoint.
+type adminClient struct {
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+}
+
+func dial(network, addr string) (*adminClient, error) {
+	conn, err := net.DialTimeout(network, addr, time.Second*10)
+	if err != nil {
+		return nil, err
+	}
+	return &adminClient{conn: conn, enc: json.NewEncoder(conn), dec: json.NewDecoder(conn)}, nil
+}
+
+// send issues request req and waits for its response.  A
+// response with an error status is returned as an error.
+func (c *adminClient) send(req curr.AdminRequest) (curr.AdminResponse, error) {
+	var resp curr.AdminResponse
+	if err := c.conn.SetDeadline(time.Now().Add(time.Second * 45)); err != nil {
+		return resp, err
+	}
+	if err := c.enc.Encode(&req); err != nil {
+		return resp, err
+	}
+	if err := c.dec.Decode(&resp); err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, fmt.Errorf("server: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+func (c *adminClient) Close() error {
+	return c.conn.Close()
+}
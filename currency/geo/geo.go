@@ -0,0 +1,182 @@
+// Package geo resolves client IP addresses to a country and
+// autonomous system (ASN) using local MaxMind databases
+// (i.e. GeoLite2-Country.mmdb and GeoLite2-ASN.mmdb), read with
+// package github.com/oschwald/geoip2-golang.
+package geo
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Unknown labels addresses that cannot be resolved, such as
+// loopback or private addresses.
+const Unknown = "unknown"
+
+// Info is the location information of an address.
+type Info struct {
+	Country string // ISO 3166-1 country code
+	ASN     uint   // autonomous system number
+	Org     string // autonomous system organization
+}
+
+// CountryLabel returns the country code, or Unknown.
+func (i Info) CountryLabel() string {
+	if i.Country == "" {
+		return Unknown
+	}
+	return i.Country
+}
+
+// ASNLabel returns the ASN as "AS<number>", or Unknown.
+func (i Info) ASNLabel() string {
+	if i.ASN == 0 {
+		return Unknown
+	}
+	return fmt.Sprintf("AS%d", i.ASN)
+}
+
+// String returns the info as it appears in access logs,
+// i.e. `country=US asn=AS15169 org="Google LLC"`.
+func (i Info) String() string {
+	s := fmt.Sprintf("country=%s asn=%s", i.CountryLabel(), i.ASNLabel())
+	if i.Org != "" {
+		s += fmt.Sprintf(" org=%q", i.Org)
+	}
+	return s
+}
+
+// Resolver looks up addresses in the MaxMind databases.  A nil
+// *Resolver is valid and resolves every address as unknown, so
+// callers do not need to check whether GeoIP is enabled.
+type Resolver struct {
+	country *geoip2.Reader
+	asn     *geoip2.Reader
+}
+
+// Open opens the country and ASN databases.  Either path may be
+// empty to skip that lookup.
+func Open(countryDB, asnDB string) (*Resolver, error) {
+	r := &Resolver{}
+	var err error
+	if countryDB != "" {
+		if r.country, err = geoip2.Open(countryDB); err != nil {
+			return nil, fmt.Errorf("geo: %v", err)
+		}
+	}
+	if asnDB != "" {
+		if r.asn, err = geoip2.Open(asnDB); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("geo: %v", err)
+		}
+	}
+	return r, nil
+}
+
+// Lookup resolves the IP address of addr, a net.Addr such as
+// the remote address of a connection.
+func (r *Resolver) Lookup(addr net.Addr) Info {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return r.LookupIP(a.IP)
+	case *net.UDPAddr:
+		return r.LookupIP(a.IP)
+	case nil:
+		return Info{}
+	default:
+		return r.LookupHostPort(addr.String())
+	}
+}
+
+// LookupHostPort resolves an address formatted as "host:port",
+// such as http.Request.RemoteAddr.
+func (r *Resolver) LookupHostPort(hostport string) Info {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	return r.LookupIP(net.ParseIP(host))
+}
+
+// LookupIP resolves ip.  Lookup errors yield empty fields.
+func (r *Resolver) LookupIP(ip net.IP) Info {
+	var info Info
+	if r == nil || ip == nil || ip.IsLoopback() || ip.IsPrivate() {
+		return info
+	}
+	if r.country != nil {
+		if rec, err := r.country.Country(ip); err == nil {
+			info.Country = rec.Country.IsoCode
+		}
+	}
+	if r.asn != nil {
+		if rec, err := r.asn.ASN(ip); err == nil {
+			info.ASN = rec.AutonomousSystemNumber
+			info.Org = rec.AutonomousSystemOrganization
+		}
+	}
+	return info
+}
+
+// Close closes the databases.
+func (r *Resolver) Close() error {
+	if r == nil {
+		return nil
+	}
+	if r.country != nil {
+		r.country.Close()
+	}
+	if r.asn != nil {
+		r.asn.Close()
+	}
+	return nil
+}
+
+// maxLabels caps the number of distinct labels a Counter keeps,
+// later labels are counted as "other" to bound memory use.
+const maxLabels = 500
+
+// Counter counts connections by country and by ASN.
+type Counter struct {
+	mu        sync.Mutex
+	countries map[string]int
+	asns      map[string]int
+}
+
+// NewCounter returns an empty Counter.
+func NewCounter() *Counter {
+	return &Counter{countries: make(map[string]int), asns: make(map[string]int)}
+}
+
+// Add counts one connection from info.
+func (c *Counter) Add(info Info) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	inc(c.countries, info.CountryLabel())
+	inc(c.asns, info.ASNLabel())
+}
+
+func inc(m map[string]int, label string) {
+	if _, ok := m[label]; !ok && len(m) >= maxLabels {
+		label = "other"
+	}
+	m[label]++
+}
+
+// Counts returns a copy of the counts by country and by ASN.
+func (c *Counter) Counts() (countries, asns map[string]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return copyMap(c.countries), copyMap(c.asns)
+}
+
+func copyMap(m map[string]int) map[string]int {
+	cp := make(map[string]int, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
@@ -0,0 +1,55 @@
+package curlib
+
+import "time"
+
+// Admin commands accepted by the admin endpoint
+// of the currency service.
+const (
+	AdminPut      = "put"      // add or replace AdminRequest.Currency
+	AdminDelete   = "delete"   // remove AdminRequest.Currency by code [and country]
+	AdminSnapshot = "snapshot" // dump the store to AdminRequest.Path
+	AdminRestore  = "restore"  // replace the store from snapshot AdminRequest.Path
+	AdminList     = "list"     // return every currency in the store
+	AdminImport   = "import"   // merge (or replace with) AdminRequest.Currencies
+	AdminStats    = "stats"    // report service health and statistics
+)
+
+// AdminRequest is sent by clients of the admin endpoint
+// as {"cmd":"put","currency":{...}}.
+type AdminRequest struct {
+	Cmd        string     `json:"cmd"`
+	Path       string     `json:"path,omitempty"`
+	Currency   *Currency  `json:"currency,omitempty"`
+	Currencies []Currency `json:"currencies,omitempty"`
+	Replace    bool       `json:"replace,omitempty"`
+	DryRun     bool       `json:"dry_run,omitempty"`
+}
+
+// AdminResponse is returned for every AdminRequest.  Count
+// holds the number of entries affected by the command.  Imports
+// also report the entries added, updated and removed (or that
+// would be, for a dry run) and list commands return the Currencies.
+type AdminResponse struct {
+	Status     string     `json:"status"`
+	Count      int        `json:"count"`
+	Added      int        `json:"added,omitempty"`
+	Updated    int        `json:"updated,omitempty"`
+	Removed    int        `json:"removed,omitempty"`
+	Currencies []Currency `json:"currencies,omitempty"`
+	Stats      *Stats     `json:"stats,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Stats is returned by the stats command.  Rates and History are
+// only set when the service refreshes exchange rates from a provider
+// and keeps a rate history, respectively.  Countries and ASNs count
+// client connections by origin when GeoIP enrichment is enabled.
+type Stats struct {
+	Started    time.Time      `json:"started"`
+	Uptime     string         `json:"uptime"`
+	Currencies int            `json:"currencies"`
+	Rates      *RateStatus    `json:"rates,omitempty"`
+	History    *HistoryStatus `json:"history,omitempty"`
+	Countries  map[string]int `json:"countries,omitempty"`
+	ASNs       map[string]int `json:"asns,omitempty"`
+}
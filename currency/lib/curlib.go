@@ -2,20 +2,56 @@ package curlib
 
 import (
 	"encoding/csv"
+	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 )
 
+// Currency is a row of data.csv.  MinorUnit was added after the
+// other fields and is omitted from JSON when empty, so existing
+// JSON clients, which ignore unknown fields, are not affected.
+// It is kept in the JSON encoding because snapshots, the
+// write-ahead log and admin updates are encoded as JSON and must
+// preserve the whole row.
 type Currency struct {
-	Code    string `json:"currency_code"`
-	Name    string `json:"currency_name"`
-	Number  string `json:"currency_number"`
-	Country string `json:"currency_country"`
+	Code      string `json:"currency_code"`
+	Name      string `json:"currency_name"`
+	Number    string `json:"currency_number"`
+	Country   string `json:"currency_country"`
+	MinorUnit string `json:"currency_minor_unit,omitempty"`
 }
 
+// CurrencyRequest searches currencies with Get, or converts
+// Amount to currency To.  From defaults to the currency of
+// Amount.  When Locale is set, conversion results include the
+// converted amount formatted for that locale.
+//
+// Historical rates are requested by setting At to a date
+// (YYYY-MM-DD), with or without an Amount, or by setting
+// Start and End to receive the daily rates in that range.
 type CurrencyRequest struct {
-	Get string `json:"get"`
+	Get    string `json:"get"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Amount *Money `json:"amount,omitempty"`
+	Locale string `json:"locale,omitempty"`
+	At     string `json:"at,omitempty"`
+	Start  string `json:"start,omitempty"`
+	End    string `json:"end,omitempty"`
+}
+
+// ConversionResult is returned for conversion requests.  Amount
+// and Result are omitted when only the rate was requested.
+type ConversionResult struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Amount    *Money    `json:"amount,omitempty"`
+	Result    *Money    `json:"result,omitempty"`
+	Rate      float64   `json:"rate"`
+	Updated   time.Time `json:"updated"`
+	Formatted string    `json:"formatted,omitempty"`
 }
 
 type CurrencyError struct {
@@ -23,21 +59,34 @@ type CurrencyError struct {
 }
 
 func Load(path string) []Currency {
-	table := make([]Currency, 0)
 	file, err := os.Open(path)
 	if err != nil {
 		panic(err.Error())
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
+	table, err := ReadCSV(file)
+	if err != nil {
+		panic(err.Error())
+	}
+	return table
+}
+
+// ReadCSV decodes currency rows, in the column order used
+// by data.csv, from r.
+func ReadCSV(r io.Reader) ([]Currency, error) {
+	table := make([]Currency, 0)
+	reader := csv.NewReader(r)
 	for {
 		row, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			panic(err.Error())
+			return nil, err
+		}
+		if len(row) < 4 {
+			return nil, fmt.Errorf("csv: expecting at least 4 columns, got %d", len(row))
 		}
 		c := Currency{
 			Country: row[0],
@@ -45,9 +94,24 @@ func Load(path string) []Currency {
 			Code:    row[2],
 			Number:  row[3],
 		}
+		if len(row) > 4 {
+			c.MinorUnit = row[4]
+		}
 		table = append(table, c)
 	}
-	return table
+	return table, nil
+}
+
+// WriteCSV encodes table to w using the column order of data.csv.
+func WriteCSV(w io.Writer, table []Currency) error {
+	writer := csv.NewWriter(w)
+	for _, c := range table {
+		if err := writer.Write([]string{c.Country, c.Name, c.Code, c.Number, c.MinorUnit}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
 }
 
 func Find(table []Currency, filter string) []Currency {
@@ -66,3 +130,64 @@ func Find(table []Currency, filter string) []Currency {
 	}
 	return result
 }
+
+// Validate checks that currency c is well-formed: a country
+// is required, while the code and number, when present, must
+// be three uppercase letters and three digits respectively.
+// The minor unit, when present, is a digit or "N.A.".
+func Validate(c Currency) error {
+	if strings.TrimSpace(c.Country) == "" {
+		return fmt.Errorf("missing country")
+	}
+	if c.Code != "" && !isCode(c.Code, 'A', 'Z') {
+		return fmt.Errorf("%s: invalid currency code %q", c.Country, c.Code)
+	}
+	if c.Number != "" && !isCode(c.Number, '0', '9') {
+		return fmt.Errorf("%s: invalid currency number %q", c.Country, c.Number)
+	}
+	if c.Code == "" && c.Number != "" {
+		return fmt.Errorf("%s: currency number without code", c.Country)
+	}
+	if c.MinorUnit != "" && c.MinorUnit != "N.A." && !(len(c.MinorUnit) == 1 && c.MinorUnit[0] >= '0' && c.MinorUnit[0] <= '9') {
+		return fmt.Errorf("%s: invalid minor unit %q", c.Country, c.MinorUnit)
+	}
+	return nil
+}
+
+// ValidateTable checks every currency in table with Validate and
+// rejects duplicate entries, which share the same code and country
+// (case-insensitive) and would otherwise be counted twice when the
+// table is merged into a Store.  All problems found are reported.
+func ValidateTable(table []Currency) error {
+	var problems []string
+	seen := make(map[string]int)
+	for i, c := range table {
+		if err := Validate(c); err != nil {
+			problems = append(problems, fmt.Sprintf("entry %d: %v", i+1, err))
+			continue
+		}
+		key := c.Code + "/" + strings.ToUpper(c.Country)
+		if prev, ok := seen[key]; ok {
+			problems = append(problems, fmt.Sprintf("entry %d: duplicates entry %d (%s %s)", i+1, prev, c.Code, c.Country))
+			continue
+		}
+		seen[key] = i + 1
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("validation failed:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// isCode returns true if s is three characters within [lo,hi].
+func isCode(s string, lo, hi byte) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < lo || s[i] > hi {
+			return false
+		}
+	}
+	return true
+}
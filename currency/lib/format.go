@@ -0,0 +1,99 @@
+package curlib
+
+import "strings"
+
+// locale describes how amounts are written for a locale.
+type locale struct {
+	group  string // thousands separator
+	point  string // decimal separator
+	suffix bool   // symbol placed after the amount
+	space  bool   // space between amount and symbol
+}
+
+// locales lists the supported locales, keyed by BCP 47 tag.
+// Lookups fall back to the language alone, then to en-US.
+// Spaces are non-breaking ("\u00a0", or the narrow "\u202f"
+// grouping digits in French) so amounts are never wrapped.
+var locales = map[string]locale{
+	"en-US": {group: ",", point: "."},
+	"en-GB": {group: ",", point: "."},
+	"en":    {group: ",", point: "."},
+	"ja-JP": {group: ",", point: "."},
+	"ja":    {group: ",", point: "."},
+	"zh-CN": {group: ",", point: "."},
+	"zh":    {group: ",", point: "."},
+	"de-DE": {group: ".", point: ",", suffix: true, space: true},
+	"de-CH": {group: "’", point: ".", space: true},
+	"de":    {group: ".", point: ",", suffix: true, space: true},
+	"es-ES": {group: ".", point: ",", suffix: true, space: true},
+	"es":    {group: ".", point: ",", suffix: true, space: true},
+	"it-IT": {group: ".", point: ",", suffix: true, space: true},
+	"it":    {group: ".", point: ",", suffix: true, space: true},
+	"nl-NL": {group: ".", point: ",", space: true},
+	"nl":    {group: ".", point: ",", space: true},
+	"pt-BR": {group: ".", point: ",", space: true},
+	"pt":    {group: ".", point: ",", suffix: true, space: true},
+	"fr-FR": {group: "\u202f", point: ",", suffix: true, space: true},
+	"fr-CH": {group: "\u202f", point: ",", suffix: true, space: true},
+	"fr":    {group: "\u202f", point: ",", suffix: true, space: true},
+	"ru-RU": {group: "\u00a0", point: ",", suffix: true, space: true},
+	"ru":    {group: "\u00a0", point: ",", suffix: true, space: true},
+}
+
+// symbols maps currency codes to their commonly used symbol.
+// Currencies not listed are written with their ISO code.
+var symbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"CNY": "¥",
+	"INR": "₹",
+	"KRW": "₩",
+	"RUB": "₽",
+	"BRL": "R$",
+	"ILS": "₪",
+	"NGN": "₦",
+	"TRY": "₺",
+	"UAH": "₴",
+	"VND": "₫",
+	"PHP": "₱",
+}
+
+// Format writes m the way it is conventionally written in locale,
+// i.e. "1.234,56 €" for de-DE or "$1,234.56" for en-US.  Unknown
+// locales are formatted using the en-US conventions.
+func (m Money) Format(tag string) string {
+	loc, ok := locales[tag]
+	if !ok {
+		lang := strings.SplitN(strings.Replace(tag, "_", "-", -1), "-", 2)[0]
+		if loc, ok = locales[strings.ToLower(lang)]; !ok {
+			loc = locales["en-US"]
+		}
+	}
+
+	exp, err := Exponent(m.Currency)
+	if err != nil {
+		exp = 0
+	}
+	amount := m.decimal(exp, loc.group, loc.point)
+
+	code := strings.ToUpper(m.Currency)
+	symbol, ok := symbols[code]
+	if !ok {
+		symbol = code
+	}
+	sep := ""
+	if loc.space || !ok {
+		sep = "\u00a0"
+	}
+
+	sign := ""
+	if m.Amount < 0 {
+		sign = "-"
+	}
+	if loc.suffix {
+		return sign + amount + sep + symbol
+	}
+	return sign + symbol + sep + amount
+}
@@ -0,0 +1,280 @@
+package curlib
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dateLayout is the layout of dates used by history queries.
+const dateLayout = "2006-01-02"
+
+// maxLookback is how far back At searches for rates when
+// none were recorded on the requested day (weekends, holidays).
+const maxLookback = 7
+
+// ErrNotRecorded is returned by At when no rates were recorded
+// on, or shortly before, the requested date.
+var ErrNotRecorded = errors.New("no exchange rates recorded")
+
+// RatePoint is the exchange rate between two currencies on a day.
+type RatePoint struct {
+	Date string  `json:"date"`
+	Rate float64 `json:"rate"`
+}
+
+// RateSeries is returned for historical range queries.
+type RateSeries struct {
+	From   string      `json:"from"`
+	To     string      `json:"to"`
+	Points []RatePoint `json:"points"`
+}
+
+// HistoryStatus reports the content of a RateHistory.
+type HistoryStatus struct {
+	Days   int    `json:"days"`
+	Oldest string `json:"oldest,omitempty"`
+	Newest string `json:"newest,omitempty"`
+}
+
+// RateHistory keeps one set of exchange rates per day.  Each
+// recorded set is appended, as a JSON-encoded line, to a file
+// so the history survives restarts.  Compact drops the days
+// older than the retention period and rewrites the file.
+type RateHistory struct {
+	mu        sync.RWMutex
+	path      string
+	file      *os.File
+	retention time.Duration
+	days      map[string]*Rates
+	dates     []string // sorted keys of days
+}
+
+// OpenRateHistory loads the history stored in file path (creating
+// it if needed) and compacts it using the retention period.
+func OpenRateHistory(path string, retention time.Duration) (*RateHistory, error) {
+	h := &RateHistory{path: path, retention: retention, days: make(map[string]*Rates)}
+
+	file, err := os.Open(path)
+	switch {
+	case err == nil:
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			var r Rates
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				// skip a torn trailing line left by a crash
+				continue
+			}
+			h.put(&r)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	if err := h.Compact(time.Now()); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Record stores r as the rates for the day it was updated,
+// replacing rates previously recorded for that day.
+func (h *RateHistory) Record(r *Rates) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := h.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	h.put(r)
+	return nil
+}
+
+// put adds r to the in-memory index, the caller must hold the lock.
+func (h *RateHistory) put(r *Rates) {
+	day := r.Updated.UTC().Format(dateLayout)
+	if _, ok := h.days[day]; !ok {
+		i := sort.SearchStrings(h.dates, day)
+		h.dates = append(h.dates, "")
+		copy(h.dates[i+1:], h.dates[i:])
+		h.dates[i] = day
+	}
+	h.days[day] = r
+}
+
+// At returns the rates recorded for date (formatted as 2006-01-02).
+// If none were recorded that day, the closest earlier day within
+// a week is used.
+func (h *RateHistory) At(date string) (*Rates, error) {
+	day, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, expecting YYYY-MM-DD", date)
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for i := 0; i <= maxLookback; i++ {
+		if r, ok := h.days[day.AddDate(0, 0, -i).Format(dateLayout)]; ok {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%w for %s", ErrNotRecorded, date)
+}
+
+// Range returns the daily rates from currency from to currency to
+// for every recorded day between start and end, inclusive.
+func (h *RateHistory) Range(from, to, start, end string) (*RateSeries, error) {
+	s, err := time.Parse(dateLayout, start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date %q, expecting YYYY-MM-DD", start)
+	}
+	e, err := time.Parse(dateLayout, end)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date %q, expecting YYYY-MM-DD", end)
+	}
+	if e.Before(s) {
+		return nil, fmt.Errorf("end date %s is before start date %s", end, start)
+	}
+
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	series := &RateSeries{From: from, To: to, Points: make([]RatePoint, 0)}
+	for i := sort.SearchStrings(h.dates, start); i < len(h.dates) && h.dates[i] <= end; i++ {
+		rate, err := h.days[h.dates[i]].Rate(from, to)
+		if err != nil {
+			continue
+		}
+		series.Points = append(series.Points, RatePoint{Date: h.dates[i], Rate: rate})
+	}
+	return series, nil
+}
+
+// Series answers range request req with the daily rates from
+// req.From to req.To.  A missing req.Start defaults to the oldest
+// recorded day and a missing req.End to today (UTC).  A nil
+// history returns ErrNoHistory.
+func (h *RateHistory) Series(req CurrencyRequest) (*RateSeries, error) {
+	if h == nil {
+		return nil, ErrNoHistory
+	}
+	start, end := req.Start, req.End
+	if start == "" {
+		start = h.Status().Oldest
+	}
+	if end == "" {
+		end = time.Now().UTC().Format(dateLayout)
+	}
+	if start == "" {
+		// nothing recorded yet
+		return &RateSeries{From: strings.ToUpper(req.From), To: strings.ToUpper(req.To), Points: []RatePoint{}}, nil
+	}
+	return h.Range(req.From, req.To, start, end)
+}
+
+// Status returns the number of days and the date range held.
+func (h *RateHistory) Status() HistoryStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	status := HistoryStatus{Days: len(h.dates)}
+	if len(h.dates) > 0 {
+		status.Oldest = h.dates[0]
+		status.Newest = h.dates[len(h.dates)-1]
+	}
+	return status
+}
+
+// Compact removes the days older than the retention period (as
+// of now) and rewrites the history file with one line per day,
+// dropping the entries superseded by a later Record.
+func (h *RateHistory) Compact(now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.retention > 0 {
+		cutoff := now.Add(-h.retention).UTC().Format(dateLayout)
+		i := sort.SearchStrings(h.dates, cutoff)
+		for _, day := range h.dates[:i] {
+			delete(h.days, day)
+		}
+		h.dates = append([]string(nil), h.dates[i:]...)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	enc := json.NewEncoder(tmp)
+	for _, day := range h.dates {
+		if err := enc.Encode(h.days[day]); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		return err
+	}
+
+	// reopen the compacted file for appending
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if h.file != nil {
+		h.file.Close()
+	}
+	h.file = file
+	return nil
+}
+
+// CompactEvery compacts the history every interval, applying the
+// retention period, until ctx is done.  Failures are logged and
+// retried at the next interval.
+func (h *RateHistory) CompactEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := h.Compact(now); err != nil {
+				log.Println("history: compaction failed:", err)
+				continue
+			}
+			status := h.Status()
+			log.Printf("history: compacted, %d days kept (%s to %s)\n", status.Days, status.Oldest, status.Newest)
+		}
+	}
+}
+
+// Close closes the history file.
+func (h *RateHistory) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
@@ -0,0 +1,180 @@
+package curlib
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestHistory returns a history holding the rates of days, which
+// are offsets from today, with 1 EUR = (1 + offset/100) USD.
+func openTestHistory(t *testing.T, retention time.Duration, days ...int) (*RateHistory, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rates.history")
+	h, err := OpenRateHistory(path, retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	today := time.Now().UTC().Truncate(time.Hour * 24)
+	for _, d := range days {
+		r := &Rates{Base: "EUR", Rates: map[string]float64{"USD": 1 + float64(d)/100}, Updated: today.AddDate(0, 0, d)}
+		if err := h.Record(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return h, path
+}
+
+func day(offset int) string {
+	return time.Now().UTC().AddDate(0, 0, offset).Format(dateLayout)
+}
+
+func TestRateHistoryAt(t *testing.T) {
+	h, _ := openTestHistory(t, 0, -20, -10, -2)
+	defer h.Close()
+
+	tests := []struct {
+		date    string
+		want    float64
+		wantErr error
+	}{
+		{date: day(-10), want: 0.90},
+		{date: day(-5), want: 0.90},  // looks back to -10
+		{date: day(0), want: 0.98},   // looks back to -2
+		{date: day(-14), want: 0.80}, // looks back to -20
+		{date: day(-10 + maxLookback - 1), want: 0.90},
+		{date: day(-20 - maxLookback - 1), wantErr: ErrNotRecorded},
+		{date: day(-12), wantErr: ErrNotRecorded}, // -20 is 8 days back
+	}
+	for _, test := range tests {
+		r, err := h.At(test.date)
+		if test.wantErr != nil {
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("At(%s) error %v, want %v", test.date, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("At(%s): %v", test.date, err)
+			continue
+		}
+		if r.Rates["USD"] != test.want {
+			t.Errorf("At(%s) = %v, want %v", test.date, r.Rates["USD"], test.want)
+		}
+	}
+	if _, err := h.At("June 1st"); err == nil || errors.Is(err, ErrNotRecorded) {
+		t.Errorf("At with invalid date returned %v", err)
+	}
+}
+
+func TestRateHistorySeries(t *testing.T) {
+	h, _ := openTestHistory(t, 0, -20, -10, -2)
+	defer h.Close()
+
+	tests := []struct {
+		name    string
+		req     CurrencyRequest
+		dates   []string
+		wantErr bool
+	}{
+		{name: "default range", req: CurrencyRequest{From: "usd", To: "eur"}, dates: []string{day(-20), day(-10), day(-2)}},
+		{name: "start only", req: CurrencyRequest{From: "EUR", To: "USD", Start: day(-10)}, dates: []string{day(-10), day(-2)}},
+		{name: "end only", req: CurrencyRequest{From: "EUR", To: "USD", End: day(-10)}, dates: []string{day(-20), day(-10)}},
+		{name: "range", req: CurrencyRequest{From: "EUR", To: "USD", Start: day(-15), End: day(-5)}, dates: []string{day(-10)}},
+		{name: "unknown currency", req: CurrencyRequest{From: "EUR", To: "XTS"}, dates: []string{}},
+		{name: "reversed", req: CurrencyRequest{From: "EUR", To: "USD", Start: day(-2), End: day(-10)}, wantErr: true},
+		{name: "invalid date", req: CurrencyRequest{From: "EUR", To: "USD", Start: "yesterday"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			series, err := h.Series(test.req)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if series.From != strings.ToUpper(test.req.From) || series.To != strings.ToUpper(test.req.To) {
+				t.Errorf("series from %s to %s, want upper case codes", series.From, series.To)
+			}
+			if len(series.Points) != len(test.dates) {
+				t.Fatalf("got %d points, want %d", len(series.Points), len(test.dates))
+			}
+			for i, p := range series.Points {
+				if p.Date != test.dates[i] {
+					t.Errorf("point %d on %s, want %s", i, p.Date, test.dates[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRateHistorySeriesEmpty(t *testing.T) {
+	h, _ := openTestHistory(t, 0)
+	defer h.Close()
+	series, err := h.Series(CurrencyRequest{From: "usd", To: "eur"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if series.From != "USD" || series.To != "EUR" || series.Points == nil || len(series.Points) != 0 {
+		t.Errorf("unexpected series %+v", series)
+	}
+
+	var none *RateHistory
+	if _, err := none.Series(CurrencyRequest{From: "USD", To: "EUR"}); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("nil history returned %v, want %v", err, ErrNoHistory)
+	}
+}
+
+func TestRateHistoryCompact(t *testing.T) {
+	h, path := openTestHistory(t, time.Hour*24*30, -40, -20, -10, -10)
+	if err := h.Compact(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if status := h.Status(); status.Days != 2 || status.Oldest != day(-20) || status.Newest != day(-10) {
+		t.Errorf("unexpected status after compaction %+v", status)
+	}
+	// records after a compaction are appended to the new file
+	today := time.Now().UTC()
+	if err := h.Record(&Rates{Base: "EUR", Rates: map[string]float64{"USD": 1}, Updated: today}); err != nil {
+		t.Fatal(err)
+	}
+	h.Close()
+
+	h, err := OpenRateHistory(path, time.Hour*24*30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if status := h.Status(); status.Days != 3 || status.Oldest != day(-20) || status.Newest != day(0) {
+		t.Errorf("unexpected status after reopening %+v", status)
+	}
+}
+
+func TestRateTableConvert(t *testing.T) {
+	h, _ := openTestHistory(t, 0, -10)
+	defer h.Close()
+	table := &RateTable{}
+	req := CurrencyRequest{From: "EUR", To: "USD"}
+
+	if _, err := table.Convert(req, h); !errors.Is(err, ErrNoRates) {
+		t.Errorf("empty table returned %v, want %v", err, ErrNoRates)
+	}
+	table.Store(&Rates{Base: "EUR", Rates: map[string]float64{"USD": 1.5}, Updated: time.Now()})
+	if conv, err := table.Convert(req, h); err != nil || conv.Rate != 1.5 {
+		t.Errorf("current rate %v (%v), want 1.5", conv, err)
+	}
+
+	req.At = day(-8)
+	if conv, err := table.Convert(req, h); err != nil || conv.Rate != 0.9 {
+		t.Errorf("historical rate %v (%v), want 0.9", conv, err)
+	}
+	if _, err := table.Convert(req, nil); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("convert without history returned %v, want %v", err, ErrNoHistory)
+	}
+}
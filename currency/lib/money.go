@@ -0,0 +1,201 @@
+package curlib
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Money is an amount expressed in the minor unit of its
+// currency, i.e. {Amount:123456, Currency:"USD"} is $1,234.56.
+// The number of minor units per major unit is given by the
+// currency exponent (see Exponent).
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// exponents maps currency codes to their minor unit exponent
+// (the minor_unit column of data.csv).  It is loaded once, at
+// startup, and is not tied to the content of any Store, so
+// runtime updates to a store do not change how Money values are
+// parsed, converted or formatted.
+var exponents = struct {
+	sync.RWMutex
+	m map[string]int
+}{m: make(map[string]int)}
+
+// RegisterExponents records the minor unit exponent of every
+// currency in table, which should be the reference data loaded
+// from data.csv.  Entries without a numeric minor unit
+// (i.e. "N.A.") are skipped.
+func RegisterExponents(table []Currency) {
+	exponents.Lock()
+	defer exponents.Unlock()
+	for _, c := range table {
+		if e, err := strconv.Atoi(c.MinorUnit); err == nil && c.Code != "" {
+			exponents.m[c.Code] = e
+		}
+	}
+}
+
+// Exponent returns the minor unit exponent of currency code.
+func Exponent(code string) (int, error) {
+	exponents.RLock()
+	defer exponents.RUnlock()
+	e, ok := exponents.m[strings.ToUpper(code)]
+	if !ok {
+		return 0, fmt.Errorf("unknown minor unit for currency %q", code)
+	}
+	return e, nil
+}
+
+// ParseMoney parses a decimal amount in major units, such as
+// "1234.56" or "-0.5", for currency code.  The amount is made of
+// digits with an optional leading minus sign and decimal point.
+// It fails if amount has more decimal places than the currency
+// exponent allows.
+func ParseMoney(amount, code string) (Money, error) {
+	code = strings.ToUpper(code)
+	exp, err := Exponent(code)
+	if err != nil {
+		return Money{}, err
+	}
+
+	amount = strings.TrimSpace(amount)
+	digits := strings.TrimPrefix(amount, "-")
+	neg := len(digits) < len(amount)
+	whole, frac := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		whole, frac = digits[:i], digits[i+1:]
+	}
+	if whole+frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return Money{}, fmt.Errorf("%q: invalid amount", amount)
+	}
+	if len(frac) > exp {
+		return Money{}, fmt.Errorf("%s: too many decimal places for %s", amount, code)
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+	minor, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%q: invalid amount", amount)
+	}
+	if neg {
+		minor = -minor
+	}
+	return Money{Amount: minor, Currency: code}, nil
+}
+
+// isDigits returns true if s only contains ASCII digits.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Add returns m+n, both amounts must be in the same currency.
+func (m Money) Add(n Money) (Money, error) {
+	if m.Currency != n.Currency {
+		return Money{}, fmt.Errorf("currency mismatch: %s and %s", m.Currency, n.Currency)
+	}
+	return Money{Amount: m.Amount + n.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m-n, both amounts must be in the same currency.
+func (m Money) Sub(n Money) (Money, error) {
+	if m.Currency != n.Currency {
+		return Money{}, fmt.Errorf("currency mismatch: %s and %s", m.Currency, n.Currency)
+	}
+	return Money{Amount: m.Amount - n.Amount, Currency: m.Currency}, nil
+}
+
+// Mul returns m multiplied by factor, rounded to the nearest minor unit.
+func (m Money) Mul(factor float64) Money {
+	return Money{Amount: int64(math.Round(float64(m.Amount) * factor)), Currency: m.Currency}
+}
+
+// Split divides m into n parts that add up to m.  The remainder
+// is spread, one minor unit at a time, over the first parts.
+func (m Money) Split(n int) ([]Money, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("cannot split into %d parts", n)
+	}
+	parts := make([]Money, n)
+	share, rem := m.Amount/int64(n), m.Amount%int64(n)
+	for i := range parts {
+		parts[i] = Money{Amount: share, Currency: m.Currency}
+		if rem > 0 {
+			parts[i].Amount++
+			rem--
+		} else if rem < 0 {
+			parts[i].Amount--
+			rem++
+		}
+	}
+	return parts, nil
+}
+
+// Convert returns m converted to currency to using rate (units of
+// to per unit of m.Currency).  The result is rounded to the minor
+// unit of the target currency, accounting for the difference in
+// exponent between the two currencies.
+func (m Money) Convert(to string, rate float64) (Money, error) {
+	to = strings.ToUpper(to)
+	fromExp, err := Exponent(m.Currency)
+	if err != nil {
+		return Money{}, err
+	}
+	toExp, err := Exponent(to)
+	if err != nil {
+		return Money{}, err
+	}
+	scale := math.Pow10(toExp - fromExp)
+	return Money{Amount: int64(math.Round(float64(m.Amount) * rate * scale)), Currency: to}, nil
+}
+
+// String returns the amount in major units followed by the
+// currency code, i.e. "1234.56 USD".
+func (m Money) String() string {
+	exp, err := Exponent(m.Currency)
+	if err != nil {
+		exp = 0
+	}
+	sign := ""
+	if m.Amount < 0 {
+		sign = "-"
+	}
+	return fmt.Sprintf("%s%s %s", sign, m.decimal(exp, "", "."), m.Currency)
+}
+
+// decimal renders the absolute amount in major units using the
+// provided group and decimal separators.
+func (m Money) decimal(exp int, group, point string) string {
+	amount := m.Amount
+	if amount < 0 {
+		amount = -amount
+	}
+	digits := strconv.FormatInt(amount, 10)
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	whole, frac := digits[:len(digits)-exp], digits[len(digits)-exp:]
+
+	// insert group separators every three digits
+	var b strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(group)
+		}
+		b.WriteRune(d)
+	}
+	if exp > 0 {
+		b.WriteString(point)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package curlib
+
+import "testing"
+
+func init() {
+	RegisterExponents([]Currency{
+		{Code: "USD", MinorUnit: "2"},
+		{Code: "EUR", MinorUnit: "2"},
+		{Code: "JPY", MinorUnit: "0"},
+		{Code: "BHD", MinorUnit: "3"},
+		{Code: "XAU", MinorUnit: "N.A."},
+	})
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		amount  string
+		code    string
+		want    int64
+		wantErr bool
+	}{
+		{amount: "1234.56", code: "USD", want: 123456},
+		{amount: "1234.5", code: "usd", want: 123450},
+		{amount: "1234", code: "USD", want: 123400},
+		{amount: "1234.", code: "USD", want: 123400},
+		{amount: ".5", code: "USD", want: 50},
+		{amount: "0", code: "USD", want: 0},
+		{amount: " 12.34 ", code: "USD", want: 1234},
+		{amount: "-12.34", code: "USD", want: -1234},
+		{amount: "-.01", code: "USD", want: -1},
+		{amount: "1500", code: "JPY", want: 1500},
+		{amount: "1.234", code: "BHD", want: 1234},
+		{amount: "92233720368547758.08", code: "USD", wantErr: true},
+		{amount: "1.234", code: "USD", wantErr: true},
+		{amount: "1.5", code: "JPY", wantErr: true},
+		{amount: "", code: "USD", wantErr: true},
+		{amount: ".", code: "USD", wantErr: true},
+		{amount: "-", code: "USD", wantErr: true},
+		{amount: "-.", code: "USD", wantErr: true},
+		{amount: "--5", code: "USD", wantErr: true},
+		{amount: "-+5", code: "USD", wantErr: true},
+		{amount: "+1", code: "USD", wantErr: true},
+		{amount: "1.-5", code: "USD", wantErr: true},
+		{amount: "1.+5", code: "USD", wantErr: true},
+		{amount: "1.2.3", code: "USD", wantErr: true},
+		{amount: "1,234.56", code: "USD", wantErr: true},
+		{amount: "1e3", code: "USD", wantErr: true},
+		{amount: "0x10", code: "USD", wantErr: true},
+		{amount: "1", code: "XAU", wantErr: true},
+		{amount: "1", code: "XXX", wantErr: true},
+	}
+
+	for _, test := range tests {
+		m, err := ParseMoney(test.amount, test.code)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q, %q) = %v, want error", test.amount, test.code, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q, %q): %v", test.amount, test.code, err)
+			continue
+		}
+		if m.Amount != test.want {
+			t.Errorf("ParseMoney(%q, %q) = %d, want %d", test.amount, test.code, m.Amount, test.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{Amount: 123456, Currency: "USD"}, "1234.56 USD"},
+		{Money{Amount: 5, Currency: "USD"}, "0.05 USD"},
+		{Money{Amount: -5, Currency: "USD"}, "-0.05 USD"},
+		{Money{Amount: 1500, Currency: "JPY"}, "1500 JPY"},
+		{Money{Amount: 1234, Currency: "BHD"}, "1.234 BHD"},
+	}
+	for _, test := range tests {
+		if got := test.money.String(); got != test.want {
+			t.Errorf("%#v.String() = %q, want %q", test.money, got, test.want)
+		}
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		money  Money
+		locale string
+		want   string
+	}{
+		{Money{Amount: 123456, Currency: "USD"}, "en-US", "$1,234.56"},
+		{Money{Amount: 123456, Currency: "EUR"}, "de-DE", "1.234,56\u00a0€"},
+		{Money{Amount: 123456, Currency: "EUR"}, "de_AT", "1.234,56\u00a0€"},
+		{Money{Amount: 123456, Currency: "EUR"}, "fr-FR", "1\u202f234,56\u00a0€"},
+		{Money{Amount: -123456, Currency: "USD"}, "en-US", "-$1,234.56"},
+		{Money{Amount: 1234567, Currency: "JPY"}, "ja-JP", "¥1,234,567"},
+		{Money{Amount: 1234, Currency: "BHD"}, "en-US", "BHD\u00a01.234"},
+		{Money{Amount: 123456, Currency: "USD"}, "xx-YY", "$1,234.56"},
+	}
+	for _, test := range tests {
+		if got := test.money.Format(test.locale); got != test.want {
+			t.Errorf("%v.Format(%q) = %q, want %q", test.money, test.locale, got, test.want)
+		}
+	}
+}
+
+func TestExponentNotChangedByStore(t *testing.T) {
+	s := NewStore([]Currency{{Code: "XTS", Country: "TESTLAND", MinorUnit: "2"}})
+	s.Put(Currency{Code: "USD", Country: "TESTLAND", MinorUnit: "0"})
+	if _, err := Exponent("XTS"); err == nil {
+		t.Error("store content registered exponent of XTS")
+	}
+	if e, err := Exponent("USD"); err != nil || e != 2 {
+		t.Errorf("Exponent(USD) = %d (%v), want 2", e, err)
+	}
+}
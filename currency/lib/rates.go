@@ -0,0 +1,320 @@
+package curlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Rates is a set of exchange rates relative to currency Base,
+// i.e. 1 Base = Rates[code] code.
+type Rates struct {
+	Base    string             `json:"base"`
+	Rates   map[string]float64 `json:"rates"`
+	Updated time.Time          `json:"updated"`
+
+	// dateOnly is set when the provider only reported the date of
+	// the rates, so Updated is midnight (UTC) of that date.
+	dateOnly bool
+}
+
+// Rate returns the exchange rate from currency from to currency to.
+func (r *Rates) Rate(from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	fromRate, err := r.rate(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := r.rate(to)
+	if err != nil {
+		return 0, err
+	}
+	return toRate / fromRate, nil
+}
+
+func (r *Rates) rate(code string) (float64, error) {
+	if code == r.Base {
+		return 1, nil
+	}
+	rate, ok := r.Rates[code]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("no exchange rate for %s", code)
+	}
+	return rate, nil
+}
+
+// Errors returned when a conversion or history query cannot be
+// answered because the server keeps no rates, or no history.
+var (
+	ErrNoRates   = errors.New("exchange rates not available")
+	ErrNoHistory = errors.New("exchange rate history not available")
+)
+
+// RateTable holds the current exchange rates.  The rates are
+// swapped atomically so readers always see a complete set.
+type RateTable struct {
+	rates atomic.Value // *Rates
+}
+
+// Load returns the current rates or nil if none were stored.
+func (t *RateTable) Load() *Rates {
+	r, _ := t.rates.Load().(*Rates)
+	return r
+}
+
+// Store replaces the current rates with r.
+func (t *RateTable) Store(r *Rates) {
+	t.rates.Store(r)
+}
+
+// Convert answers conversion request req using rates r.  From
+// defaults to the currency of req.Amount and, without an amount,
+// only the exchange rate is returned.
+func (r *Rates) Convert(req CurrencyRequest) (*ConversionResult, error) {
+	from := strings.ToUpper(req.From)
+	if from == "" && req.Amount != nil {
+		from = strings.ToUpper(req.Amount.Currency)
+	}
+	if req.Amount != nil && req.Amount.Currency != "" && !strings.EqualFold(req.Amount.Currency, from) {
+		return nil, fmt.Errorf("amount currency %s does not match %s", req.Amount.Currency, from)
+	}
+	rate, err := r.Rate(from, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	conv := &ConversionResult{
+		From:    from,
+		To:      strings.ToUpper(req.To),
+		Rate:    rate,
+		Updated: r.Updated,
+	}
+	if req.Amount != nil {
+		amount := Money{Amount: req.Amount.Amount, Currency: from}
+		result, err := amount.Convert(req.To, rate)
+		if err != nil {
+			return nil, err
+		}
+		conv.Amount, conv.Result = &amount, &result
+		if req.Locale != "" {
+			conv.Formatted = result.Format(req.Locale)
+		}
+	}
+	return conv, nil
+}
+
+// Convert answers conversion request req using the current rates
+// held in t or, when req.At is set, the rates recorded in history
+// on that date.  History is nil when no history is kept.
+func (t *RateTable) Convert(req CurrencyRequest, history *RateHistory) (*ConversionResult, error) {
+	rates := t.Load()
+	if req.At != "" {
+		if history == nil {
+			return nil, ErrNoHistory
+		}
+		var err error
+		if rates, err = history.At(req.At); err != nil {
+			return nil, err
+		}
+	}
+	if rates == nil {
+		return nil, ErrNoRates
+	}
+	return rates.Convert(req)
+}
+
+// providerRates is the payload returned by ECB or openexchangerates
+// style HTTP APIs, i.e. {"base":"EUR","date":"2023-06-01","rates":{...}}.
+// Some providers send a unix timestamp instead of a date.
+type providerRates struct {
+	Base      string             `json:"base"`
+	Date      string             `json:"date"`
+	Timestamp int64              `json:"timestamp"`
+	Rates     map[string]float64 `json:"rates"`
+}
+
+// FetchRates retrieves the latest rates from the provider at url.
+func FetchRates(ctx context.Context, client *http.Client, url string) (*Rates, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rates: provider returned %s", resp.Status)
+	}
+
+	var payload providerRates
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("rates: %v", err)
+	}
+	if payload.Base == "" || len(payload.Rates) == 0 {
+		return nil, fmt.Errorf("rates: provider returned no rates")
+	}
+
+	rates := &Rates{Base: strings.ToUpper(payload.Base), Rates: payload.Rates, Updated: time.Now().UTC()}
+	switch {
+	case payload.Timestamp > 0:
+		rates.Updated = time.Unix(payload.Timestamp, 0).UTC()
+	case payload.Date != "":
+		if d, err := time.Parse("2006-01-02", payload.Date); err == nil {
+			rates.Updated, rates.dateOnly = d, true
+		}
+	}
+	return rates, nil
+}
+
+// dailyStaleAfter is the default age after which rates reported
+// with a date only are stale.  Such providers, like the ECB, publish
+// once per working day, so their rates are a day old by the time
+// they are published and over three days old on a Monday morning.
+const dailyStaleAfter = time.Hour * 24 * 4
+
+// RateRefresher periodically fetches exchange rates from URL and
+// stores them in Table, and in History when it is set.  Failed
+// fetches are retried with an exponential backoff, and a warning
+// is logged, after every refresh attempt, while the rates in the
+// table are older than StaleAfter.  The age of the rates is based
+// on the time reported by the provider, not on the time of the
+// fetch, so a provider serving outdated rates is also detected.
+// When StaleAfter is zero, rates are stale after three Intervals,
+// or after four days when the provider only reports their date.
+type RateRefresher struct {
+	URL        string
+	Table      *RateTable
+	History    *RateHistory
+	Client     *http.Client
+	Interval   time.Duration
+	StaleAfter time.Duration
+	MaxRetries int
+
+	mu          sync.Mutex
+	lastRefresh time.Time
+	lastError   error
+}
+
+// RateStatus reports the state of a RateRefresher.
+type RateStatus struct {
+	Base        string    `json:"base,omitempty"`
+	Count       int       `json:"count"`
+	Updated     time.Time `json:"updated,omitempty"`
+	LastRefresh time.Time `json:"last_refresh,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	Stale       bool      `json:"stale"`
+}
+
+// Status returns the current state of the refresher.
+func (r *RateRefresher) Status() RateStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := RateStatus{LastRefresh: r.lastRefresh, Stale: r.stale()}
+	if r.lastError != nil {
+		status.LastError = r.lastError.Error()
+	}
+	if rates := r.Table.Load(); rates != nil {
+		status.Base = rates.Base
+		status.Count = len(rates.Rates)
+		status.Updated = rates.Updated
+	}
+	return status
+}
+
+// stale returns true if there are no rates in the table, or
+// if they were updated by the provider more than StaleAfter ago.
+func (r *RateRefresher) stale() bool {
+	rates := r.Table.Load()
+	return rates == nil || time.Since(rates.Updated) > r.staleAfter(rates)
+}
+
+// staleAfter returns the age after which rates are stale.
+func (r *RateRefresher) staleAfter(rates *Rates) time.Duration {
+	if r.StaleAfter > 0 {
+		return r.StaleAfter
+	}
+	after := r.Interval * 3
+	if rates.dateOnly && after < dailyStaleAfter {
+		after = dailyStaleAfter
+	}
+	return after
+}
+
+// warnStale logs a warning if the rates in the table are stale.
+func (r *RateRefresher) warnStale() {
+	if !r.stale() {
+		return
+	}
+	updated := "never"
+	if rates := r.Table.Load(); rates != nil {
+		updated = rates.Updated.Format(time.RFC3339)
+	}
+	log.Printf("rates: WARNING exchange rates are stale (updated: %s)\n", updated)
+}
+
+// Run refreshes the rates immediately then every Interval
+// until ctx is done.  Interval must be greater than zero.
+func (r *RateRefresher) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		r.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh fetches the rates, retrying with a doubling delay
+// on failure, and stores them in the table on success.
+func (r *RateRefresher) refresh(ctx context.Context) {
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		rates, err := FetchRates(ctx, r.Client, r.URL)
+		if err == nil {
+			r.Table.Store(rates)
+			r.mu.Lock()
+			r.lastRefresh = time.Now()
+			r.lastError = nil
+			r.mu.Unlock()
+			log.Printf("rates: refreshed %d rates (base %s)\n", len(rates.Rates), rates.Base)
+			if r.History != nil {
+				if err := r.History.Record(rates); err != nil {
+					log.Println("rates: failed to record history:", err)
+				}
+			}
+			r.warnStale()
+			return
+		}
+
+		r.mu.Lock()
+		r.lastError = err
+		r.mu.Unlock()
+		log.Printf("rates: refresh failed (attempt %d): %v\n", attempt+1, err)
+		r.warnStale()
+
+		if attempt >= r.MaxRetries {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > r.Interval {
+			delay = r.Interval
+		}
+	}
+}
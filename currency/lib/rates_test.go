@@ -0,0 +1,75 @@
+package curlib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchRatesUpdated(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		updated  time.Time
+		dateOnly bool
+	}{
+		{
+			name:    "timestamp",
+			payload: `{"base":"usd","timestamp":1685620800,"rates":{"EUR":0.93}}`,
+			updated: time.Unix(1685620800, 0).UTC(),
+		},
+		{
+			name:     "date",
+			payload:  `{"base":"EUR","date":"2023-06-01","rates":{"USD":1.07}}`,
+			updated:  time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+			dateOnly: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, test.payload)
+			}))
+			defer srv.Close()
+
+			rates, err := FetchRates(context.Background(), srv.Client(), srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !rates.Updated.Equal(test.updated) || rates.dateOnly != test.dateOnly {
+				t.Errorf("updated %v (date only %t), want %v (%t)", rates.Updated, rates.dateOnly, test.updated, test.dateOnly)
+			}
+		})
+	}
+}
+
+func TestRateRefresherStale(t *testing.T) {
+	tests := []struct {
+		name       string
+		age        time.Duration
+		dateOnly   bool
+		staleAfter time.Duration
+		want       bool
+	}{
+		{name: "fresh", age: time.Hour * 2},
+		{name: "three intervals", age: time.Hour*3 + time.Minute, want: true},
+		{name: "date only, over a weekend", age: time.Hour * 88, dateOnly: true},
+		{name: "date only, four days", age: time.Hour*96 + time.Minute, dateOnly: true, want: true},
+		{name: "explicit", age: time.Hour * 5, staleAfter: time.Hour * 6},
+		{name: "explicit, date only", age: time.Hour * 7, dateOnly: true, staleAfter: time.Hour * 6, want: true},
+	}
+	for _, test := range tests {
+		table := &RateTable{}
+		r := &RateRefresher{Table: table, Interval: time.Hour, StaleAfter: test.staleAfter}
+		if !r.stale() {
+			t.Errorf("%s: empty table is not stale", test.name)
+		}
+		table.Store(&Rates{Base: "EUR", Updated: time.Now().Add(-test.age), dateOnly: test.dateOnly})
+		if got := r.stale(); got != test.want {
+			t.Errorf("%s: stale %t, want %t", test.name, got, test.want)
+		}
+	}
+}
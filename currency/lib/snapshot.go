@@ -0,0 +1,102 @@
+package curlib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SnapshotVersion is the version of the snapshot format
+// written by WriteSnapshot.
+const SnapshotVersion = 1
+
+// Snapshot is the on-disk representation of a store dump.
+// Checksum is the hex-encoded SHA-256 sum of the compacted
+// JSON value stored in Currencies.
+type Snapshot struct {
+	Version    int             `json:"version"`
+	Created    time.Time       `json:"created"`
+	Checksum   string          `json:"checksum"`
+	Currencies json.RawMessage `json:"currencies"`
+}
+
+// WriteSnapshot encodes table as a versioned snapshot to w.
+func WriteSnapshot(w io.Writer, table []Currency) error {
+	data, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	snap := Snapshot{
+		Version:    SnapshotVersion,
+		Created:    time.Now().UTC(),
+		Checksum:   hex.EncodeToString(sum[:]),
+		Currencies: data,
+	}
+	return json.NewEncoder(w).Encode(&snap)
+}
+
+// ReadSnapshot decodes a snapshot from r and returns its
+// currencies after the version and checksum are verified.
+func ReadSnapshot(r io.Reader) ([]Currency, error) {
+	var snap Snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("snapshot: %v", err)
+	}
+	if snap.Version != SnapshotVersion {
+		return nil, fmt.Errorf("snapshot: unsupported version %d", snap.Version)
+	}
+	var data bytes.Buffer
+	if err := json.Compact(&data, snap.Currencies); err != nil {
+		return nil, fmt.Errorf("snapshot: %v", err)
+	}
+	sum := sha256.Sum256(data.Bytes())
+	if hex.EncodeToString(sum[:]) != snap.Checksum {
+		return nil, fmt.Errorf("snapshot: checksum mismatch")
+	}
+	var table []Currency
+	if err := json.Unmarshal(data.Bytes(), &table); err != nil {
+		return nil, fmt.Errorf("snapshot: %v", err)
+	}
+	return table, nil
+}
+
+// SaveSnapshot writes the content of store s to file path.
+// The snapshot is written to a temporary file first then
+// renamed so that a failed dump never clobbers a good one.
+func SaveSnapshot(path string, s *Store) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := WriteSnapshot(tmp, s.Currencies()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot reads and verifies the snapshot stored in file path.
+func LoadSnapshot(path string) ([]Currency, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadSnapshot(file)
+}
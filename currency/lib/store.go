@@ -0,0 +1,128 @@
+package curlib
+
+import (
+	"strings"
+	"sync"
+)
+
+// Store is a mutable, concurrency-safe currency table.
+// Lookups take a read lock so that connection handlers
+// can search the table while admin commands modify it.
+type Store struct {
+	mu    sync.RWMutex
+	table []Currency
+}
+
+// NewStore returns a Store seeded with the provided table.
+func NewStore(table []Currency) *Store {
+	s := &Store{}
+	s.Replace(table)
+	return s
+}
+
+// Find searches the store using the same rules as function Find.
+// The returned slice is a copy and is safe to use after the call.
+func (s *Store) Find(filter string) []Currency {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := Find(s.table, filter)
+	return append(make([]Currency, 0, len(result)), result...)
+}
+
+// Currencies returns a copy of the entire table.
+func (s *Store) Currencies() []Currency {
+	return s.Find("*")
+}
+
+// Len returns the number of entries in the store.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.table)
+}
+
+// Put adds currency c to the store.  An entry is identified by
+// its code and country; if one already exists it is replaced.
+func (s *Store) Put(c Currency) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(c)
+}
+
+// Merge puts every currency from table into the store and
+// returns the number of entries added and updated.
+func (s *Store) Merge(table []Currency) (added, updated int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range table {
+		if s.put(c) {
+			updated++
+		} else {
+			added++
+		}
+	}
+	return added, updated
+}
+
+// Diff reports how many entries from table would be added
+// and updated by Merge, without modifying the store.
+func (s *Store) Diff(table []Currency) (added, updated int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range table {
+		if s.index(c) >= 0 {
+			updated++
+		} else {
+			added++
+		}
+	}
+	return added, updated
+}
+
+// put adds or replaces c, it returns true on replace.
+// The caller must hold the write lock.
+func (s *Store) put(c Currency) bool {
+	if i := s.index(c); i >= 0 {
+		s.table[i] = c
+		return true
+	}
+	s.table = append(s.table, c)
+	return false
+}
+
+// index returns the position of the entry with the same
+// code and country as c, or -1.
+func (s *Store) index(c Currency) int {
+	for i, cur := range s.table {
+		if cur.Code == c.Code && strings.EqualFold(cur.Country, c.Country) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Remove deletes entries with the given code.  When country is
+// not empty, only the entry for that country is removed.  It
+// returns the number of entries removed.
+func (s *Store) Remove(code, country string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.table[:0]
+	for _, cur := range s.table {
+		if cur.Code == code && (country == "" || strings.EqualFold(cur.Country, country)) {
+			continue
+		}
+		kept = append(kept, cur)
+	}
+	removed := len(s.table) - len(kept)
+	s.table = kept
+	return removed
+}
+
+// Replace swaps the content of the store with table.
+func (s *Store) Replace(table []Currency) {
+	cp := append(make([]Currency, 0, len(table)), table...)
+	s.mu.Lock()
+	s.table = cp
+	s.mu.Unlock()
+}
@@ -0,0 +1,280 @@
+package curlib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Operations recorded in the write-ahead log.
+const (
+	WALPut     = "put"
+	WALDelete  = "delete"
+	WALMerge   = "merge"
+	WALReplace = "replace"
+)
+
+// WALEntry is a single mutation recorded in the write-ahead log.
+// Currency is set for put and delete, Table is set for merge
+// and replace.
+type WALEntry struct {
+	Seq      int64      `json:"seq"`
+	Time     time.Time  `json:"time"`
+	Op       string     `json:"op"`
+	Currency *Currency  `json:"currency,omitempty"`
+	Table    []Currency `json:"table,omitempty"`
+}
+
+// Apply performs the mutation described by e on store s.
+func (e WALEntry) Apply(s *Store) error {
+	switch e.Op {
+	case WALPut:
+		if e.Currency == nil {
+			return fmt.Errorf("wal: entry %d: put without currency", e.Seq)
+		}
+		s.Put(*e.Currency)
+	case WALDelete:
+		if e.Currency == nil {
+			return fmt.Errorf("wal: entry %d: delete without currency", e.Seq)
+		}
+		s.Remove(e.Currency.Code, e.Currency.Country)
+	case WALMerge:
+		s.Merge(e.Table)
+	case WALReplace:
+		s.Replace(e.Table)
+	default:
+		return fmt.Errorf("wal: entry %d: unknown op %q", e.Seq, e.Op)
+	}
+	return nil
+}
+
+// WAL is an append-only log of store mutations.  Each entry is
+// written as one JSON-encoded line and synced to disk before
+// Append returns, so a mutation is only applied once it is durable.
+//
+// The log grows with every mutation until it is checkpointed, which
+// rewrites it as a single replace entry holding the whole table.
+type WAL struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	seq  int64
+	size int64
+}
+
+// OpenWAL opens (or creates) the log at path, replays its entries
+// on top of store s and returns the log ready for appending.  A
+// partially written trailing entry, left behind by a crash during
+// Append, is discarded.  It returns the number of entries replayed.
+func OpenWAL(path string, s *Store) (*WAL, int, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	w := &WAL{path: path, file: file}
+	count, offset, err := w.replay(s)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	// drop the torn tail, if any, and position for appending
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	w.size = offset
+	return w, count, nil
+}
+
+// CreateWAL creates the log at path, discarding any previous
+// content, with table as its starting point.  See RestoreWAL to
+// keep the previous content when it holds unsaved updates.
+func CreateWAL(path string, table []Currency) (*WAL, error) {
+	w := &WAL{path: path}
+	if err := w.rewrite(table); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// replay applies every complete entry in the log to s and returns
+// the count of entries and the offset following the last one.
+func (w *WAL) replay(s *Store) (int, int64, error) {
+	return scanWAL(w.file, func(entry WALEntry) error {
+		if err := entry.Apply(s); err != nil {
+			return err
+		}
+		w.seq = entry.Seq
+		return nil
+	})
+}
+
+// scanWAL calls fn with every complete entry read from r and
+// returns the count of entries and the offset following the last.
+func scanWAL(r io.Reader, fn func(WALEntry) error) (int, int64, error) {
+	reader := bufio.NewReader(r)
+	var count int
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a line without its newline was never fully written
+			return count, offset, nil
+		}
+		if err != nil {
+			return count, offset, err
+		}
+
+		var entry WALEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			return count, offset, fmt.Errorf("wal: corrupt entry at offset %d: %v", offset, err)
+		}
+		if err := fn(entry); err != nil {
+			return count, offset, err
+		}
+		offset += int64(len(line))
+		count++
+	}
+}
+
+// RestoreWAL starts a new log at path from table, the content of
+// a restored snapshot, as CreateWAL does.  Entries recorded in the
+// old log after its checkpoint (its leading replace entry) may not
+// be part of any snapshot, so such a log is kept, rather than
+// discarded, as path.<time>.bak.  It returns the name of the backup
+// and the number of entries it holds past the checkpoint, if any.
+func RestoreWAL(path string, table []Currency) (w *WAL, backup string, pending int, err error) {
+	file, err := os.Open(path)
+	switch {
+	case err == nil:
+		first := true
+		_, _, err := scanWAL(file, func(entry WALEntry) error {
+			if !first || entry.Op != WALReplace {
+				pending++
+			}
+			first = false
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return nil, "", 0, err
+		}
+		if pending > 0 {
+			backup = fmt.Sprintf("%s.%s.bak", path, time.Now().UTC().Format("20060102T150405"))
+			if err := os.Rename(path, backup); err != nil {
+				return nil, "", 0, err
+			}
+		}
+	case !os.IsNotExist(err):
+		return nil, "", 0, err
+	}
+
+	if w, err = CreateWAL(path, table); err != nil {
+		return nil, "", 0, err
+	}
+	return w, backup, pending, nil
+}
+
+// Append assigns the next sequence number to entry and
+// writes it durably to the log.
+func (w *WAL) Append(entry WALEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entry.Seq = w.seq + 1
+	entry.Time = time.Now().UTC()
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := w.file.Write(data); err != nil {
+		w.rollback()
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.rollback()
+		return err
+	}
+	w.seq = entry.Seq
+	w.size += int64(len(data))
+	return nil
+}
+
+// Checkpoint rewrites the log as a single replace entry holding
+// table, the current content of the store, so that the log no
+// longer grows with every mutation and replaying it yields table.
+// The caller must ensure no mutation is applied to the store
+// between reading table and the return of Checkpoint.
+func (w *WAL) Checkpoint(table []Currency) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rewrite(table)
+}
+
+// rewrite replaces the log file with one holding a single replace
+// entry.  The entry is written to a temporary file then renamed,
+// so a failed checkpoint leaves the previous log in place.
+func (w *WAL) rewrite(table []Currency) error {
+	entry := WALEntry{Seq: w.seq + 1, Time: time.Now().UTC(), Op: WALReplace, Table: table}
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	// the renamed file is the log from now on
+	if _, err := tmp.Seek(0, io.SeekEnd); err != nil {
+		tmp.Close()
+		return err
+	}
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file = tmp
+	w.seq = entry.Seq
+	w.size = int64(len(data))
+	return nil
+}
+
+// rollback discards a partially written entry so that
+// later appends do not follow a torn line.
+func (w *WAL) rollback() {
+	w.file.Truncate(w.size)
+	w.file.Seek(w.size, io.SeekStart)
+}
+
+// Close closes the underlying log file.
+func (w *WAL) Close() error {
+	return w.file.Close()
+}
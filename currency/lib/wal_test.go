@@ -0,0 +1,247 @@
+package curlib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var walBase = []Currency{
+	{Code: "USD", Name: "US Dollar", Number: "840", Country: "UNITED STATES", MinorUnit: "2"},
+	{Code: "EUR", Name: "Euro", Number: "978", Country: "FRANCE", MinorUnit: "2"},
+}
+
+func walLine(t *testing.T, e WALEntry) string {
+	t.Helper()
+	data, err := json.Marshal(&e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data) + "\n"
+}
+
+func TestWALReplay(t *testing.T) {
+	xts := &Currency{Code: "XTS", Name: "Test", Number: "963", Country: "TESTLAND", MinorUnit: "2"}
+	put := walLine(t, WALEntry{Seq: 1, Op: WALPut, Currency: xts})
+	del := walLine(t, WALEntry{Seq: 2, Op: WALDelete, Currency: &Currency{Code: "EUR"}})
+	rep := walLine(t, WALEntry{Seq: 3, Op: WALReplace, Table: []Currency{*xts}})
+
+	tests := []struct {
+		name    string
+		log     string
+		count   int      // entries replayed
+		codes   []string // codes in the store after replay
+		size    int      // size of the log after open
+		wantErr bool
+	}{
+		{name: "empty", log: "", count: 0, codes: []string{"USD", "EUR"}},
+		{name: "put", log: put, count: 1, codes: []string{"USD", "EUR", "XTS"}, size: len(put)},
+		{name: "put delete", log: put + del, count: 2, codes: []string{"USD", "XTS"}, size: len(put + del)},
+		{name: "replace", log: put + rep, count: 2, codes: []string{"XTS"}, size: len(put + rep)},
+		{name: "torn tail", log: put + del[:len(del)/2], count: 1, codes: []string{"USD", "EUR", "XTS"}, size: len(put)},
+		{name: "tail without newline", log: put + strings.TrimSpace(del), count: 1, codes: []string{"USD", "EUR", "XTS"}, size: len(put)},
+		{name: "corrupt entry", log: "{oops}\n" + put, wantErr: true},
+		{name: "unknown op", log: `{"seq":1,"op":"drop"}` + "\n", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.wal")
+			if err := os.WriteFile(path, []byte(test.log), 0644); err != nil {
+				t.Fatal(err)
+			}
+			s := NewStore(walBase)
+			w, count, err := OpenWAL(path, s)
+			if test.wantErr {
+				if err == nil {
+					w.Close()
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			if count != test.count {
+				t.Errorf("replayed %d entries, want %d", count, test.count)
+			}
+			if got := storeCodes(s); got != strings.Join(test.codes, ",") {
+				t.Errorf("store has %s, want %s", got, strings.Join(test.codes, ","))
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != int64(test.size) {
+				t.Errorf("log size %d, want %d", info.Size(), test.size)
+			}
+		})
+	}
+}
+
+func TestWALAppendAfterTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	put := walLine(t, WALEntry{Seq: 1, Op: WALPut, Currency: &Currency{Code: "XTS", Country: "TESTLAND"}})
+	if err := os.WriteFile(path, []byte(put+`{"seq":2,"op":"del`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, _, err := OpenWAL(path, NewStore(walBase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Append(WALEntry{Op: WALDelete, Currency: &Currency{Code: "USD"}}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	s := NewStore(walBase)
+	w, count, err := OpenWAL(path, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if count != 2 {
+		t.Errorf("replayed %d entries, want 2", count)
+	}
+	if got := storeCodes(s); got != "EUR,XTS" {
+		t.Errorf("store has %s, want EUR,XTS", got)
+	}
+}
+
+func TestWALCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	s := NewStore(walBase)
+	w, _, err := OpenWAL(path, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xts := Currency{Code: "XTS", Country: "TESTLAND"}
+	for _, e := range []WALEntry{
+		{Op: WALPut, Currency: &xts},
+		{Op: WALDelete, Currency: &Currency{Code: "USD"}},
+	} {
+		if err := w.Append(e); err != nil {
+			t.Fatal(err)
+		}
+		e.Apply(s)
+	}
+	if err := w.Checkpoint(s.Currencies()); err != nil {
+		t.Fatal(err)
+	}
+	// appends continue after the checkpoint
+	if err := w.Append(WALEntry{Op: WALDelete, Currency: &Currency{Code: "EUR"}}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// the base table no longer matters once checkpointed
+	replayed := NewStore(nil)
+	w, count, err := OpenWAL(path, replayed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if count != 2 {
+		t.Errorf("replayed %d entries, want 2", count)
+	}
+	if got := storeCodes(replayed); got != "XTS" {
+		t.Errorf("store has %s, want XTS", got)
+	}
+	if w.seq != 4 {
+		t.Errorf("sequence %d, want 4", w.seq)
+	}
+}
+
+func TestCreateWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	put := walLine(t, WALEntry{Seq: 1, Op: WALPut, Currency: &Currency{Code: "XTS"}})
+	if err := os.WriteFile(path, []byte(put), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := CreateWAL(path, walBase[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	s := NewStore(walBase)
+	w, count, err := OpenWAL(path, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if count != 1 {
+		t.Errorf("replayed %d entries, want 1", count)
+	}
+	if got := storeCodes(s); got != "EUR" {
+		t.Errorf("store has %s, want EUR", got)
+	}
+}
+
+func TestRestoreWAL(t *testing.T) {
+	checkpoint := walLine(t, WALEntry{Seq: 1, Op: WALReplace, Table: walBase})
+	put := walLine(t, WALEntry{Seq: 2, Op: WALPut, Currency: &Currency{Code: "XTS", Country: "TESTLAND"}})
+	replace := walLine(t, WALEntry{Seq: 2, Op: WALReplace, Table: walBase[:1]})
+
+	tests := []struct {
+		name    string
+		log     string // content of the old log, "" for none
+		pending int
+	}{
+		{name: "no log", log: ""},
+		{name: "checkpoint only", log: checkpoint},
+		{name: "checkpoint with torn tail", log: checkpoint + put[:10]},
+		{name: "updates after checkpoint", log: checkpoint + put, pending: 1},
+		{name: "replace after checkpoint", log: checkpoint + replace, pending: 1},
+		{name: "no checkpoint", log: put + put, pending: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.wal")
+			if test.log != "" {
+				if err := os.WriteFile(path, []byte(test.log), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w, backup, pending, err := RestoreWAL(path, walBase[1:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Close()
+			if pending != test.pending {
+				t.Errorf("%d pending entries, want %d", pending, test.pending)
+			}
+
+			if test.pending == 0 {
+				if backup != "" {
+					t.Errorf("unexpected backup %s of the old log", backup)
+				}
+			} else if data, err := os.ReadFile(backup); string(data) != test.log {
+				t.Errorf("backup holds %q (%v), want the old log", data, err)
+			}
+
+			s := NewStore(walBase)
+			w, _, err = OpenWAL(path, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			if got := storeCodes(s); got != "EUR" {
+				t.Errorf("store has %s, want EUR", got)
+			}
+		})
+	}
+}
+
+func storeCodes(s *Store) string {
+	var codes []string
+	for _, c := range s.Currencies() {
+		codes = append(codes, c.Code)
+	}
+	return strings.Join(codes, ",")
+}
@@ -0,0 +1,208 @@
+// Package logsink ships log output to a local or remote syslog
+// endpoint.  Each line written to a sink is formatted as an
+// RFC 5424 syslog message and sent over UDP, TCP, or a unix
+// domain socket, i.e.
+//
+//   <30>1 2023-06-01T10:00:00.000000Z host servjson5 4242 admin - admin: put XTS
+//
+// A sink is an io.Writer, meant to be installed with log.SetOutput.
+package logsink
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// writeTimeout bounds the time a Write, and a redial, may block
+// the logger when the endpoint stalls.  Messages that cannot be
+// sent in time are dropped, logging must not stall the program.
+const writeTimeout = time.Second
+
+// Syslog facility and severities used by the sink (RFC 5424 6.2.1).
+const (
+	facilityDaemon  = 3
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+// Sink is an io.Writer that sends each line as a syslog message.
+type Sink struct {
+	mu       sync.Mutex
+	network  string
+	addr     string
+	conn     net.Conn  // nil after a failure, until redialed
+	retry    time.Time // no redial is attempted before retry
+	hostname string
+	app      string
+	pid      int
+}
+
+// Open connects to the syslog endpoint described by spec and
+// returns a sink which tags messages with app.  Spec is one of:
+//
+//   syslog                   local syslog daemon (/dev/log)
+//   udp://host:514           remote syslog over UDP (default port 514)
+//   tcp://host:601           remote syslog over TCP, octet-counted (default port 601)
+//   unixgram:///dev/log      local datagram socket
+//   unix:///path/to/socket   local stream socket (octet-counted)
+func Open(spec, app string) (*Sink, error) {
+	network, addr, err := parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s := &Sink{
+		network:  network,
+		addr:     addr,
+		hostname: hostname,
+		app:      app,
+		pid:      os.Getpid(),
+	}
+	if err := s.dial(time.Second * 10); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parse splits a sink spec into a network and address.
+func parse(spec string) (string, string, error) {
+	if spec == "syslog" {
+		for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+			if _, err := os.Stat(path); err == nil {
+				return "unixgram", path, nil
+			}
+		}
+		return "", "", fmt.Errorf("logsink: no local syslog socket found")
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return "", "", fmt.Errorf("logsink: %v", err)
+	}
+	switch u.Scheme {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+		if u.Port() != "" {
+			return u.Scheme, u.Host, nil
+		}
+		// syslog over TCP has its own port (RFC 6587)
+		port := "514"
+		if strings.HasPrefix(u.Scheme, "tcp") {
+			port = "601"
+		}
+		return u.Scheme, net.JoinHostPort(u.Hostname(), port), nil
+	case "unix", "unixgram":
+		return u.Scheme, u.Path, nil
+	default:
+		return "", "", fmt.Errorf("logsink: unsupported sink %q", spec)
+	}
+}
+
+func (s *Sink) dial(timeout time.Duration) error {
+	conn, err := net.DialTimeout(s.network, s.addr, timeout)
+	if err != nil {
+		return fmt.Errorf("logsink: %v", err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// stream returns true if messages need octet-counting framing
+// (RFC 6587) because the transport does not preserve boundaries.
+func (s *Sink) stream() bool {
+	return strings.HasPrefix(s.network, "tcp") || s.network == "unix"
+}
+
+// Write sends every line in p as a syslog message.  A message
+// that cannot be sent within writeTimeout is dropped, and the
+// connection is closed since a stream may hold a partial message.
+// A connection that failed for another reason is redialed once,
+// then not again for a few seconds while messages are dropped.
+func (s *Sink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var failed error
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		msg := s.format(line, time.Now())
+		if s.stream() {
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+		err := s.send(msg)
+		if err != nil && !isTimeout(err) {
+			err = s.send(msg)
+		}
+		if err != nil {
+			failed = err
+		}
+	}
+	if failed != nil {
+		return 0, failed
+	}
+	return len(p), nil
+}
+
+// send writes msg to the endpoint, dialing it first if the
+// previous connection failed.
+func (s *Sink) send(msg string) error {
+	if s.conn == nil {
+		if time.Now().Before(s.retry) {
+			return fmt.Errorf("logsink: %s unavailable, message dropped", s.addr)
+		}
+		if err := s.dial(writeTimeout); err != nil {
+			s.retry = time.Now().Add(writeTimeout * 5)
+			return err
+		}
+	}
+	if err := s.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(s.conn, msg); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// format renders line as an RFC 5424 message.  A leading "word:"
+// in the line (i.e. "admin:" or "rates:") is used as the MSGID and
+// lines containing "WARNING" are sent with the warning severity.
+func (s *Sink) format(line string, t time.Time) string {
+	severity := severityInfo
+	if strings.Contains(line, "WARNING") {
+		severity = severityWarning
+	}
+	msgID := "-"
+	if i := strings.Index(line, ": "); i > 0 && i <= 32 && !strings.ContainsAny(line[:i], " []\"=") {
+		msgID = line[:i]
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		facilityDaemon*8+severity,
+		t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname, s.app, s.pid, msgID, line,
+	)
+}
+
+// Close closes the connection to the syslog endpoint.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
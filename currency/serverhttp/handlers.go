@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	curr "github.com/vladimirvivien/go-networking/currency/lib"
+)
+
+// handleCurrencies searches currencies, i.e. GET /currencies?get=usd
+func handleCurrencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	writeJSON(w, http.StatusOK, store.Find(r.URL.Query().Get("get")))
+}
+
+// handleConvert converts an amount, expressed in major units, using
+// the current or historical rates, i.e. GET /convert?from=USD&to=EUR&amount=10.50
+func handleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	q := r.URL.Query()
+	req := curr.CurrencyRequest{
+		From:   q.Get("from"),
+		To:     q.Get("to"),
+		Locale: q.Get("locale"),
+		At:     q.Get("at"),
+	}
+	if req.From == "" || req.To == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("from and to are required"))
+		return
+	}
+	if amount := q.Get("amount"); amount != "" {
+		m, err := curr.ParseMoney(amount, req.From)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		req.Amount = &m
+	}
+
+	result, err := rates.Convert(req, history)
+	if err != nil {
+		writeError(w, queryStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleHistory returns daily rates for charting,
+// i.e. GET /history?from=USD&to=EUR&start=2023-05-01&end=2023-06-01
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	q := r.URL.Query()
+	req := curr.CurrencyRequest{
+		From:  q.Get("from"),
+		To:    q.Get("to"),
+		Start: q.Get("start"),
+		End:   q.Get("end"),
+	}
+	if req.From == "" || req.To == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("from and to are required"))
+		return
+	}
+	series, err := history.Series(req)
+	if err != nil {
+		writeError(w, queryStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, series)
+}
+
+// queryStatus returns the HTTP status for an error returned
+// while answering a conversion or history query.
+func queryStatus(err error) int {
+	switch {
+	case errors.Is(err, curr.ErrNoRates), errors.Is(err, curr.ErrNoHistory):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, curr.ErrNotRecorded):
+		return http.StatusNotFound
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("failed to send response:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &curr.CurrencyError{Error: err.Error()})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/vladimirvivien/go-networking/currency/geo"
+	curr "github.com/vladimirvivien/go-networking/currency/lib"
+	"github.com/vladimirvivien/go-networking/currency/logsink"
+)
+
+var (
+	store     *curr.Store
+	rates     = &curr.RateTable{}
+	refresher *curr.RateRefresher
+	history   *curr.RateHistory
+	resolver  *geo.Resolver
+)
+
+// This program exposes the currency service as a REST API over
+// HTTP.  The same handlers (see handlers.go) are served over TCP,
+// using HTTP/1.1 or HTTP/2 as negotiated with TLS ALPN, and over
+// QUIC using HTTP/3 (package github.com/quic-go/quic-go/http3).
+//
+//   GET /currencies?get=<currency name,code,or country>
+//   GET /convert?from=USD&to=EUR&amount=1234.56[&locale=de-DE][&at=2023-06-01]
+//   GET /history?from=USD&to=EUR[&start=2023-05-01][&end=2023-06-01]
+//
+// Focus:
+// Browsers and other clients do not attempt HTTP/3 out of the blue.
+// Responses sent over TCP carry an Alt-Svc header advertising that
+// the same service is available via HTTP/3 on the UDP port, which
+// clients may then switch to for subsequent requests.  The access
+// log reports the protocol of each request so readers can compare
+// the behavior of the transports with the same handlers.  When
+// MaxMind databases are provided, each access log line also reports
+// the country and autonomous system of the client (see package geo).
+//
+// Testing:
+//   curl --cacert ../certs/ca-cert.pem -v https://localhost:4443/currencies?get=usd
+//   curl --http3 --cacert ../certs/ca-cert.pem https://localhost:4443/currencies?get=usd
+//
+// Usage: server [options]
+// options:
+//   -e host endpoint, for both TCP and UDP, default ":4443"
+//   -cert public cert, default "../certs/localhost-cert.pem"
+//   -key private key, default "../certs/localhost-key.pem"
+//   -data currency CSV file, default "../data.csv"
+//   -h3 serve HTTP/3, default true
+//   -rates exchange rate provider URL, default "" (no conversion)
+//   -rates-every rate refresh interval, default 1h
+//   -rates-stale age, from the provider's date, after which rates are reported stale, default 3x interval (96h if date only)
+//   -history rate history file, default "rates.history"
+//   -retention rate history retention period, default 8760h (one year)
+//   -geoip-country MaxMind country database (i.e. GeoLite2-Country.mmdb), default ""
+//   -geoip-asn MaxMind ASN database (i.e. GeoLite2-ASN.mmdb), default ""
+//   -log-sink syslog sink [syslog,udp://host:514,tcp://host:601,unixgram:///dev/log], default stderr
+func main() {
+	var addr, cert, key, data, ratesURL, histPath, logSink, geoCountry, geoASN string
+	var ratesEvery, ratesStale, retention time.Duration
+	var h3 bool
+	flag.StringVar(&addr, "e", ":4443", "service endpoint [ip addr]")
+	flag.StringVar(&cert, "cert", "../certs/localhost-cert.pem", "public cert")
+	flag.StringVar(&key, "key", "../certs/localhost-key.pem", "private key")
+	flag.StringVar(&data, "data", "../data.csv", "currency CSV data file")
+	flag.BoolVar(&h3, "h3", true, "serve HTTP/3 over QUIC")
+	flag.StringVar(&ratesURL, "rates", "", "exchange rate provider URL")
+	flag.DurationVar(&ratesEvery, "rates-every", time.Hour, "exchange rate refresh interval")
+	flag.DurationVar(&ratesStale, "rates-stale", 0, "age after which exchange rates are stale")
+	flag.StringVar(&histPath, "history", "rates.history", "exchange rate history file")
+	flag.DurationVar(&retention, "retention", time.Hour*24*365, "exchange rate history retention")
+	flag.StringVar(&geoCountry, "geoip-country", "", "MaxMind GeoIP2/GeoLite2 country database")
+	flag.StringVar(&geoASN, "geoip-asn", "", "MaxMind GeoIP2/GeoLite2 ASN database")
+	flag.StringVar(&logSink, "log-sink", "", "syslog sink [syslog,udp://host:port,tcp://host:port,unix[gram]://path]")
+	flag.Parse()
+
+	// ship logs to syslog, which adds its own timestamp
+	if logSink != "" {
+		sink, err := logsink.Open(logSink, "servhttp")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer sink.Close()
+		log.SetFlags(0)
+		log.SetOutput(sink)
+	}
+
+	// minor units used by Money come from the base CSV data
+	table := curr.Load(data)
+	curr.RegisterExponents(table)
+	store = curr.NewStore(table)
+
+	// open GeoIP databases used to enrich access logs
+	if geoCountry != "" || geoASN != "" {
+		r, err := geo.Open(geoCountry, geoASN)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer r.Close()
+		resolver = r
+	}
+
+	// start the exchange rate refresher
+	if ratesURL != "" {
+		if ratesEvery <= 0 {
+			log.Fatal("-rates-every must be greater than zero")
+		}
+		h, err := curr.OpenRateHistory(histPath, retention)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer h.Close()
+		history = h
+		go history.CompactEvery(context.Background(), time.Hour*24)
+
+		refresher = &curr.RateRefresher{
+			URL:        ratesURL,
+			Table:      rates,
+			History:    history,
+			Client:     &http.Client{Timeout: time.Second * 30},
+			Interval:   ratesEvery,
+			StaleAfter: ratesStale,
+			MaxRetries: 5,
+		}
+		go refresher.Run(context.Background())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/currencies", handleCurrencies)
+	mux.HandleFunc("/convert", handleConvert)
+	mux.HandleFunc("/history", handleHistory)
+
+	log.Println("**** Global Currency Service (HTTP) ***")
+
+	// HTTP/3 server, over QUIC (UDP)
+	var h3Server *http3.Server
+	if h3 {
+		h3Server = &http3.Server{
+			Addr:    addr,
+			Handler: accessLog(mux),
+		}
+		go func() {
+			log.Printf("HTTP/3 service started: (udp) %s\n", addr)
+			if err := h3Server.ListenAndServeTLS(cert, key); err != nil {
+				log.Println("HTTP/3 server:", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// HTTP/1.1 and HTTP/2 server, over TLS (TCP).  When HTTP/3 is
+	// enabled, responses advertise it with an Alt-Svc header.
+	var handler http.Handler = accessLog(mux)
+	if h3Server != nil {
+		handler = altSvc(h3Server, handler)
+	}
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		TLSConfig:    &tls.Config{MinVersion: tls.VersionTLS12},
+		ReadTimeout:  time.Second * 45,
+		WriteTimeout: time.Second * 45,
+	}
+	log.Printf("HTTP/1.1, HTTP/2 service started: (tcp) %s\n", addr)
+	if err := server.ListenAndServeTLS(cert, key); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// altSvc adds the Alt-Svc header, advertising the HTTP/3
+// endpoint, to every response sent by h.
+func altSvc(h3Server *http3.Server, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := h3Server.SetQUICHeaders(w.Header()); err != nil {
+			log.Println("failed to set Alt-Svc header:", err)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// accessLog logs the protocol, method, path, status, and
+// duration of every request served by h, along with the
+// origin of the client when GeoIP is enabled.
+func accessLog(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		origin := ""
+		if resolver != nil {
+			origin = " " + resolver.LookupHostPort(r.RemoteAddr).String()
+		}
+		log.Printf("%s %s %s %s %d (%s)%s\n", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI(), sw.status, time.Since(start), origin)
+	})
+}
+
+// statusWriter records the status code written by a handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
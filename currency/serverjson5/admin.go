@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	curr "github.com/vladimirvivien/go-networking/currency/lib"
+)
+
+// serveAdmin accepts connections on the admin endpoint. Admin
+// clients send JSON-encoded curr.AdminRequest values and receive
+// a curr.AdminResponse for each.  The endpoint should only be
+// bound to a trusted address (localhost or a unix socket).
+func serveAdmin(ln net.Listener, snap string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(time.Millisecond * 10)
+				continue
+			}
+			log.Println("admin:", err)
+			return
+		}
+		log.Println("admin connected to ", conn.RemoteAddr())
+		go handleAdmin(conn, snap)
+	}
+}
+
+// handle admin connection
+func handleAdmin(conn net.Conn, snap string) {
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Println("admin: error closing connection:", err)
+		}
+	}()
+
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		if err := conn.SetDeadline(time.Now().Add(time.Second * 90)); err != nil {
+			log.Println("admin: failed to set deadline:", err)
+			return
+		}
+
+		var req curr.AdminRequest
+		if err := dec.Decode(&req); err != nil {
+			if err != io.EOF {
+				log.Println("admin: closing connection:", err)
+			}
+			return
+		}
+
+		resp := runAdmin(req, snap)
+		if err := enc.Encode(&resp); err != nil {
+			log.Println("admin: failed to send response:", err)
+			return
+		}
+	}
+}
+
+// adminMu serializes admin commands so that mutations are
+// applied to the store in the same order they are logged.
+var adminMu sync.Mutex
+
+// runAdmin applies an admin command to the store.  Mutations
+// are appended to the write-ahead log before they are applied.
+func runAdmin(req curr.AdminRequest, snap string) curr.AdminResponse {
+	adminMu.Lock()
+	defer adminMu.Unlock()
+
+	switch req.Cmd {
+	case curr.AdminPut:
+		if req.Currency == nil || req.Currency.Code == "" {
+			return adminError(fmt.Errorf("put: missing currency"))
+		}
+		if err := curr.Validate(*req.Currency); err != nil {
+			return adminError(fmt.Errorf("put: %v", err))
+		}
+		if err := wal.Append(curr.WALEntry{Op: curr.WALPut, Currency: req.Currency}); err != nil {
+			return adminError(err)
+		}
+		store.Put(*req.Currency)
+		log.Printf("admin: put %s (%s)\n", req.Currency.Code, req.Currency.Country)
+		return curr.AdminResponse{Status: "ok", Count: 1}
+
+	case curr.AdminDelete:
+		if req.Currency == nil || req.Currency.Code == "" {
+			return adminError(fmt.Errorf("delete: missing currency code"))
+		}
+		if err := wal.Append(curr.WALEntry{Op: curr.WALDelete, Currency: req.Currency}); err != nil {
+			return adminError(err)
+		}
+		n := store.Remove(req.Currency.Code, req.Currency.Country)
+		log.Printf("admin: deleted %d entries for %s\n", n, req.Currency.Code)
+		return curr.AdminResponse{Status: "ok", Count: n}
+
+	case curr.AdminSnapshot:
+		path, err := snapshotPath(req.Path, snap)
+		if err != nil {
+			return adminError(err)
+		}
+		if err := curr.SaveSnapshot(path, store); err != nil {
+			return adminError(err)
+		}
+		log.Printf("admin: snapshot of %d currencies saved to %s\n", store.Len(), path)
+
+		// the snapshot is a consistent point, checkpoint the log
+		if err := wal.Checkpoint(store.Currencies()); err != nil {
+			log.Println("admin: wal checkpoint failed:", err)
+		}
+		return curr.AdminResponse{Status: "ok", Count: store.Len()}
+
+	case curr.AdminRestore:
+		path, err := snapshotPath(req.Path, snap)
+		if err != nil {
+			return adminError(err)
+		}
+		table, err := curr.LoadSnapshot(path)
+		if err != nil {
+			return adminError(err)
+		}
+		// the restored table supersedes the log
+		if err := wal.Checkpoint(table); err != nil {
+			return adminError(err)
+		}
+		store.Replace(table)
+		log.Printf("admin: restored %d currencies from %s\n", len(table), path)
+		return curr.AdminResponse{Status: "ok", Count: len(table)}
+
+	case curr.AdminStats:
+		stats := &curr.Stats{
+			Started:    started,
+			Uptime:     time.Since(started).Round(time.Second).String(),
+			Currencies: store.Len(),
+		}
+		if refresher != nil {
+			status := refresher.Status()
+			stats.Rates = &status
+		}
+		if history != nil {
+			status := history.Status()
+			stats.History = &status
+		}
+		if origins != nil {
+			stats.Countries, stats.ASNs = origins.Counts()
+		}
+		return curr.AdminResponse{Status: "ok", Count: stats.Currencies, Stats: stats}
+
+	case curr.AdminList:
+		table := store.Currencies()
+		return curr.AdminResponse{Status: "ok", Count: len(table), Currencies: table}
+
+	case curr.AdminImport:
+		if err := curr.ValidateTable(req.Currencies); err != nil {
+			return adminError(fmt.Errorf("import: %v", err))
+		}
+		if req.Replace {
+			added, updated := store.Diff(req.Currencies)
+			resp := curr.AdminResponse{
+				Status:  "ok",
+				Count:   len(req.Currencies),
+				Added:   added,
+				Updated: updated,
+				Removed: store.Len() - updated,
+			}
+			if req.DryRun {
+				return resp
+			}
+			if err := wal.Append(curr.WALEntry{Op: curr.WALReplace, Table: req.Currencies}); err != nil {
+				return adminError(err)
+			}
+			store.Replace(req.Currencies)
+			log.Printf("admin: import replaced store with %d currencies\n", len(req.Currencies))
+			return resp
+		}
+		if req.DryRun {
+			added, updated := store.Diff(req.Currencies)
+			return curr.AdminResponse{Status: "ok", Count: added + updated, Added: added, Updated: updated}
+		}
+		if err := wal.Append(curr.WALEntry{Op: curr.WALMerge, Table: req.Currencies}); err != nil {
+			return adminError(err)
+		}
+		added, updated := store.Merge(req.Currencies)
+		log.Printf("admin: import merged %d currencies (%d added, %d updated)\n", added+updated, added, updated)
+		return curr.AdminResponse{Status: "ok", Count: added + updated, Added: added, Updated: updated}
+
+	default:
+		return adminError(fmt.Errorf("unknown command %q", req.Cmd))
+	}
+}
+
+// snapshotPath resolves the snapshot file named in a request.
+// Admin clients may only name files in the directory of the
+// default snapshot, so the server never reads or writes
+// arbitrary paths on their behalf.
+func snapshotPath(name, snap string) (string, error) {
+	if name == "" {
+		return snap, nil
+	}
+	base := filepath.Base(name)
+	if base == "." || base == ".." || base == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid snapshot name %q", name)
+	}
+	return filepath.Join(filepath.Dir(snap), base), nil
+}
+
+func adminError(err error) curr.AdminResponse {
+	log.Println("admin:", err)
+	return curr.AdminResponse{Status: "error", Error: err.Error()}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/vladimirvivien/go-networking/currency/geo"
+	curr "github.com/vladimirvivien/go-networking/currency/lib"
+	"github.com/vladimirvivien/go-networking/currency/logsink"
+)
+
+var (
+	store     *curr.Store
+	wal       *curr.WAL
+	rates     = &curr.RateTable{}
+	refresher *curr.RateRefresher
+	history   *curr.RateHistory
+	started   = time.Now()
+	resolver  *geo.Resolver
+	origins   *geo.Counter
+)
+
+// This program implements a simple currency lookup service
+// over TCP or Unix Data Socket. It loads ISO currency
+// information using package curr (see above) and uses a simple
+// JSON-encode text-based protocol to exchange data with a client.
+//
+// Clients send currency search requests as JSON objects
+// as {"Get":"<currency name,code,or country"}. The request data is
+// then unmarshalled to Go type curr.CurrencyRequest using
+// the encoding/json package.
+//
+// The request is then used to search the list of
+// currencies. The search result, a []curr.Currency, is marshalled
+// as JSON array of objects and sent to the client.
+//
+// Focus:
+// This version of the server makes the currency data mutable.  The
+// table is kept in a curr.Store and a second listener exposes an
+// admin endpoint (see admin.go) which accepts commands to add or
+// remove currencies, dump the store to a snapshot file, or restore
+// the store from one.  Snapshots are versioned and carry a checksum
+// which is verified before the data is used.
+//
+// Every admin mutation is first appended to a write-ahead log (WAL)
+// and synced to disk before it is applied to the store.  At startup,
+// the log is replayed on top of the base CSV data so runtime edits
+// survive a crash or restart.  Taking or restoring a snapshot
+// checkpoints the log, which is rewritten to hold the whole table,
+// and restoring a snapshot at startup starts a new log from it.  Any
+// updates logged after the last checkpoint are then kept in a backup
+// of the old log (<wal>.<time>.bak) and reported in the log.
+//
+// When a rate provider URL is configured, a background refresher
+// periodically pulls exchange rates from an ECB/openexchangerates
+// style HTTP API and atomically swaps them into the conversion table
+// used to answer conversion requests.  Amounts are exchanged as
+// curr.Money values, in minor units, such as:
+//   {"to":"EUR","amount":{"amount":1000,"currency":"USD"},"locale":"de-DE"}
+// Failed fetches are retried with backoff, stale rates are reported
+// in the log, and the time of the last refresh is reported by the
+// admin stats command.
+//
+// Each refreshed set of rates is also recorded, per day, in a rate
+// history file.  Historical rates are requested with a date, as in
+// {"from":"USD","to":"EUR","at":"2023-06-01"}, and daily points for
+// charting with a range, as in
+// {"from":"USD","to":"EUR","start":"2023-05-01","end":"2023-06-01"}.
+// Once a day, the history is compacted to drop the days older than
+// the retention period.
+//
+// With flag -log-sink, log output is formatted as RFC 5424 messages
+// and shipped to a local or remote syslog endpoint over UDP, TCP, or
+// a unix domain socket (see package logsink).
+//
+// When MaxMind databases are provided, the address of each client is
+// resolved to a country and autonomous system (see package geo).  The
+// origin is added to the connection log and connections are counted
+// by country and ASN in the admin stats view.
+//
+// Testing:
+// Netcat can be used for rudimentary testing.  However, use clientjsonX
+// programs functional tests.  Admin commands can be sent with netcat:
+//   echo '{"cmd":"snapshot"}' | nc localhost 4041
+//
+// Usage: server [options]
+// options:
+//   -e host endpoint, default ":4040"
+//   -n network protocol [tcp,unix], default "tcp"
+//   -a admin endpoint, default "localhost:4041"
+//   -an admin network protocol [tcp,unix], default "tcp"
+//   -data currency CSV file, default "../data.csv"
+//   -snap default snapshot file, default "currency.snap", admin
+//         snapshot and restore commands may only name files in its directory
+//   -restore snapshot file to load at startup instead of the CSV data
+//   -wal write-ahead log file, default "currency.wal"
+//   -rates exchange rate provider URL, default "" (no conversion)
+//   -rates-every rate refresh interval, default 1h
+//   -rates-stale age, from the provider's date, after which rates are reported stale, default 3x interval (96h if date only)
+//   -history rate history file, default "rates.history"
+//   -retention rate history retention period, default 8760h (one year)
+//   -geoip-country MaxMind country database (i.e. GeoLite2-Country.mmdb), default ""
+//   -geoip-asn MaxMind ASN database (i.e. GeoLite2-ASN.mmdb), default ""
+//   -log-sink syslog sink [syslog,udp://host:514,tcp://host:601,unixgram:///dev/log], default stderr
+func main() {
+	// setup flags
+	var addr, network, adminAddr, adminNetwork, data, snap, restore, walPath, ratesURL, histPath, logSink, geoCountry, geoASN string
+	var ratesEvery, ratesStale, retention time.Duration
+	flag.StringVar(&addr, "e", ":4040", "service endpoint [ip addr or socket path]")
+	flag.StringVar(&network, "n", "tcp", "network protocol [tcp,unix]")
+	flag.StringVar(&adminAddr, "a", "localhost:4041", "admin endpoint [ip addr or socket path]")
+	flag.StringVar(&adminNetwork, "an", "tcp", "admin network protocol [tcp,unix]")
+	flag.StringVar(&data, "data", "../data.csv", "currency CSV data file")
+	flag.StringVar(&snap, "snap", "currency.snap", "default snapshot file")
+	flag.StringVar(&restore, "restore", "", "snapshot file to restore at startup")
+	flag.StringVar(&walPath, "wal", "currency.wal", "write-ahead log file")
+	flag.StringVar(&ratesURL, "rates", "", "exchange rate provider URL")
+	flag.DurationVar(&ratesEvery, "rates-every", time.Hour, "exchange rate refresh interval")
+	flag.DurationVar(&ratesStale, "rates-stale", 0, "age after which exchange rates are stale")
+	flag.StringVar(&histPath, "history", "rates.history", "exchange rate history file")
+	flag.DurationVar(&retention, "retention", time.Hour*24*365, "exchange rate history retention")
+	flag.StringVar(&geoCountry, "geoip-country", "", "MaxMind GeoIP2/GeoLite2 country database")
+	flag.StringVar(&geoASN, "geoip-asn", "", "MaxMind GeoIP2/GeoLite2 ASN database")
+	flag.StringVar(&logSink, "log-sink", "", "syslog sink [syslog,udp://host:port,tcp://host:port,unix[gram]://path]")
+	flag.Parse()
+
+	// ship logs to syslog, which adds its own timestamp
+	if logSink != "" {
+		sink, err := logsink.Open(logSink, "servjson5")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer sink.Close()
+		log.SetFlags(0)
+		log.SetOutput(sink)
+	}
+
+	// validate supported network protocols
+	for _, n := range []string{network, adminNetwork} {
+		switch n {
+		case "tcp", "tcp4", "tcp6", "unix":
+		default:
+			fmt.Println("unsupported network protocol")
+			os.Exit(1)
+		}
+	}
+
+	// minor units used by Money come from the base CSV data only,
+	// updates to the table do not change them
+	base := curr.Load(data)
+	curr.RegisterExponents(base)
+
+	// load the currency table from a snapshot, if one is provided,
+	// which starts a new write-ahead log.  Otherwise, start from the
+	// base CSV data and replay the runtime updates recorded in the log.
+	if restore != "" {
+		table, err := curr.LoadSnapshot(restore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store = curr.NewStore(table)
+		w, backup, pending, err := curr.RestoreWAL(walPath, table)
+		if err != nil {
+			log.Fatal(err)
+		}
+		wal = w
+		if pending > 0 {
+			log.Printf("WARNING %d updates in %s are not part of snapshot %s, kept in %s\n", pending, walPath, restore, backup)
+		}
+		log.Printf("restored %d currencies from snapshot %s, %s reset\n", store.Len(), restore, walPath)
+	} else {
+		store = curr.NewStore(base)
+		w, replayed, err := curr.OpenWAL(walPath, store)
+		if err != nil {
+			log.Fatal(err)
+		}
+		wal = w
+		log.Printf("replayed %d updates from %s (%d currencies)\n", replayed, walPath, store.Len())
+	}
+	defer wal.Close()
+
+	// open GeoIP databases used to enrich connection metadata
+	if geoCountry != "" || geoASN != "" {
+		r, err := geo.Open(geoCountry, geoASN)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer r.Close()
+		resolver, origins = r, geo.NewCounter()
+	}
+
+	// start the exchange rate refresher
+	if ratesURL != "" {
+		if ratesEvery <= 0 {
+			log.Fatal("-rates-every must be greater than zero")
+		}
+		h, err := curr.OpenRateHistory(histPath, retention)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer h.Close()
+		history = h
+		go history.CompactEvery(context.Background(), time.Hour*24)
+
+		refresher = &curr.RateRefresher{
+			URL:        ratesURL,
+			Table:      rates,
+			History:    history,
+			Client:     &http.Client{Timeout: time.Second * 30},
+			Interval:   ratesEvery,
+			StaleAfter: ratesStale,
+			MaxRetries: 5,
+		}
+		go refresher.Run(context.Background())
+	}
+
+	// create a listener for provided network and host address
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	defer ln.Close()
+	log.Println("**** Global Currency Service ***")
+	log.Printf("Service started: (%s) %s\n", network, addr)
+
+	// start the admin endpoint
+	adminLn, err := net.Listen(adminNetwork, adminAddr)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	defer adminLn.Close()
+	log.Printf("Admin started: (%s) %s\n", adminNetwork, adminAddr)
+	go serveAdmin(adminLn, snap)
+
+	// delay to sleep when accept fails with a temporary error
+	acceptDelay := time.Millisecond * 10
+	acceptCount := 0
+
+	// connection loop
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			switch e := err.(type) {
+			case net.Error:
+				// if temporary error, attempt to connect again
+				if e.Temporary() {
+					if acceptCount > 5 {
+						log.Printf("unable to connect after %d retries: %v", acceptCount, err)
+						return
+					}
+					acceptDelay *= 2
+					acceptCount++
+					time.Sleep(acceptDelay)
+					continue
+				}
+			default:
+				log.Println(err)
+				continue
+			}
+			acceptDelay = time.Millisecond * 10
+			acceptCount = 0
+		}
+		if resolver != nil {
+			info := resolver.Lookup(conn.RemoteAddr())
+			origins.Add(info)
+			log.Println("Connected to ", conn.RemoteAddr(), info)
+		} else {
+			log.Println("Connected to ", conn.RemoteAddr())
+		}
+		go handleConnection(conn)
+	}
+}
+
+// handle client connection
+func handleConnection(conn net.Conn) {
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Println("error closing connection:", err)
+		}
+	}()
+
+	// set initial deadline prior to entering
+	// the client request/response loop to 45 seconds.
+	// This means that the client has 45 seconds to send
+	// its initial request or loose the connection.
+	if err := conn.SetDeadline(time.Now().Add(time.Second * 45)); err != nil {
+		log.Println("failed to set deadline:", err)
+		return
+	}
+
+	// command-loop
+	for {
+		dec := json.NewDecoder(conn)
+		var req curr.CurrencyRequest
+		if err := dec.Decode(&req); err != nil {
+			switch err := err.(type) {
+			//network error: disconnect
+			case net.Error:
+				if err.Timeout() {
+					log.Println("deadline reached, disconnecting...")
+				}
+				log.Println("network error:", err)
+				return
+			default:
+				if err == io.EOF {
+					log.Println("closing connection:", err)
+					return
+				}
+				enc := json.NewEncoder(conn)
+				if encerr := enc.Encode(&curr.CurrencyError{Error: err.Error()}); encerr != nil {
+					log.Println("failed error encoding:", encerr)
+					return
+				}
+				continue
+			}
+		}
+
+		// convert or search currencies
+		var result interface{}
+		if req.From != "" || req.To != "" {
+			var err error
+			if req.Start != "" || req.End != "" {
+				result, err = history.Series(req)
+			} else {
+				result, err = rates.Convert(req, history)
+			}
+			if err != nil {
+				result = &curr.CurrencyError{Error: err.Error()}
+			}
+		} else {
+			result = store.Find(req.Get)
+		}
+
+		// send result
+		enc := json.NewEncoder(conn)
+		if err := enc.Encode(result); err != nil {
+			switch err := err.(type) {
+			case net.Error:
+				log.Println("failed to send response:", err)
+				return
+			default:
+				if encerr := enc.Encode(&curr.CurrencyError{Error: err.Error()}); encerr != nil {
+					log.Println("failed to send error:", encerr)
+					return
+				}
+				continue
+			}
+		}
+
+		// renew deadline for 90 secs later
+		if err := conn.SetDeadline(time.Now().Add(time.Second * 90)); err != nil {
+			log.Println("failed to set deadline:", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// This program is a small netcat clone.  It connects to, or listens
+// on, a TCP, UDP, or Unix domain socket endpoint and pipes data
+// between the connection and stdin/stdout.  It can be used to talk
+// to any of the servers in this repository, i.e.:
+//
+//   echo '{"get":"USD"}' | gonc localhost:4040
+//   head -c 48 /dev/zero | gonc -n udp -x localhost:1123 > /dev/null
+//   gonc -tls -ca ../currency/certs/ca-cert.pem localhost:4443
+//   gonc -l -k :4040
+//
+// Focus:
+// The program shows how the same piping logic applies to stream
+// (tcp, unix) and datagram (udp, unixgram) protocols.  Stream
+// connections are treated as io.Reader and io.Writer.  Datagram
+// listeners use net.PacketConn and reply to the address of the
+// last datagram received, so they only read stdin once a first
+// datagram is received, i.e. echo pong | gonc -l -n udp :5056.  When stdin reaches EOF, stream
+// connections are half-closed (CloseWrite) so the peer sees EOF
+// while responses can still be read.  Datagram protocols have no
+// EOF, a client quits shortly after sending all of stdin instead.
+//
+// Usage: gonc [options] address
+// options:
+//   -l listen for a connection on address instead of connecting
+//   -k with -l, keep listening for connections after one closes
+//   -n network protocol [tcp,tcp4,tcp6,udp,udp4,udp6,unix,unixgram], default "tcp"
+//   -tls use TLS (stream protocols only)
+//   -cert, -key certificate and private key for TLS (required with -l)
+//   -ca root CA certificate used to verify the peer
+//   -insecure with -tls, skip server certificate verification
+//   -x hexdump sent and received data to stderr
+//   -w idle timeout, closes the connection when no data moves, default 0 (none)
+//   -q delay to quit after stdin EOF, default 0 (wait for the peer to close),
+//      or 2s for datagram clients
+func main() {
+	var network, cert, key, ca string
+	var listen, keep, useTLS, insecure, dump bool
+	var idle, quit time.Duration
+	flag.BoolVar(&listen, "l", false, "listen mode")
+	flag.BoolVar(&keep, "k", false, "keep listening after a connection closes")
+	flag.StringVar(&network, "n", "tcp", "network protocol [tcp,udp,unix,unixgram]")
+	flag.BoolVar(&useTLS, "tls", false, "use TLS")
+	flag.StringVar(&cert, "cert", "", "TLS certificate")
+	flag.StringVar(&key, "key", "", "TLS private key")
+	flag.StringVar(&ca, "ca", "", "root CA certificate")
+	flag.BoolVar(&insecure, "insecure", false, "skip TLS certificate verification")
+	flag.BoolVar(&dump, "x", false, "hexdump traffic to stderr")
+	flag.DurationVar(&idle, "w", 0, "idle timeout")
+	flag.DurationVar(&quit, "q", 0, "delay to quit after stdin EOF (default wait for the peer, 2s for datagram clients)")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: gonc [options] address")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	addr := flag.Arg(0)
+
+	var tlsConfig *tls.Config
+	if useTLS {
+		var err error
+		if tlsConfig, err = configureTLS(listen, cert, key, ca, insecure); err != nil {
+			fmt.Fprintln(os.Stderr, "gonc:", err)
+			os.Exit(1)
+		}
+	}
+
+	// when the peer closes first, piped input still gets a moment
+	// to be sent, unless stdin is shared by successive connections.
+	p := &pipe{idle: idle, quit: quit, linger: time.Second, dump: dump}
+	if listen && keep {
+		p.linger = 0
+	}
+	var err error
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		if listen {
+			err = listenStream(network, addr, tlsConfig, keep, p)
+		} else {
+			err = dialStream(network, addr, tlsConfig, p)
+		}
+	case "udp", "udp4", "udp6", "unixgram":
+		if tlsConfig != nil {
+			err = fmt.Errorf("TLS is not supported over %s", network)
+		} else if listen {
+			err = listenPacket(network, addr, p)
+		} else {
+			// no EOF comes back, wait a little for responses
+			if p.quit == 0 {
+				p.quit = time.Second * 2
+			}
+			err = dialPacket(network, addr, p)
+		}
+	default:
+		err = fmt.Errorf("unsupported network protocol %q", network)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gonc:", err)
+		os.Exit(1)
+	}
+}
+
+// configureTLS builds the TLS configuration.  Listeners must
+// present a certificate; clients verify the server using the
+// provided CA, the system roots, or not at all (-insecure).
+func configureTLS(listen bool, cert, key, ca string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if cert != "" || key != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	if listen && len(config.Certificates) == 0 {
+		return nil, fmt.Errorf("-cert and -key are required to listen with TLS")
+	}
+	if ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", ca)
+		}
+		// a listener uses the CA to verify client certificates
+		if listen {
+			config.ClientCAs = pool
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			config.RootCAs = pool
+		}
+	}
+	return config, nil
+}
+
+// dialStream connects to a stream endpoint and pipes stdin/stdout.
+func dialStream(network, addr string, config *tls.Config, p *pipe) error {
+	var conn net.Conn
+	var err error
+	if config != nil {
+		conn, err = tls.Dial(network, addr, config)
+	} else {
+		conn, err = net.Dial(network, addr)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "connected to %s (%s)\n", conn.RemoteAddr(), network)
+	return p.stream(conn, newStdinReader())
+}
+
+// listenStream accepts a connection, or one after the other when
+// keep is set, and pipes it to stdin/stdout.
+func listenStream(network, addr string, config *tls.Config, keep bool, p *pipe) error {
+	var ln net.Listener
+	var err error
+	if config != nil {
+		ln, err = tls.Listen(network, addr, config)
+	} else {
+		ln, err = net.Listen(network, addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	fmt.Fprintf(os.Stderr, "listening on %s (%s)\n", ln.Addr(), network)
+
+	// stdin is shared by successive connections
+	stdin := newStdinReader()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "connection from %s\n", conn.RemoteAddr())
+		if err := p.stream(conn, stdin); err != nil {
+			fmt.Fprintln(os.Stderr, "gonc:", err)
+		}
+		if !keep {
+			return nil
+		}
+	}
+}
+
+// dialPacket sends stdin to a datagram endpoint and writes
+// datagrams received to stdout.
+func dialPacket(network, addr string, p *pipe) error {
+	var conn net.Conn
+	var err error
+	if network == "unixgram" {
+		// a unixgram client must be bound to a path
+		// for the server to be able to reply.
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("gonc-%d.sock", os.Getpid()))
+		defer os.Remove(path)
+		laddr := &net.UnixAddr{Name: path, Net: network}
+		raddr, rerr := net.ResolveUnixAddr(network, addr)
+		if rerr != nil {
+			return rerr
+		}
+		conn, err = net.DialUnix(network, laddr, raddr)
+	} else {
+		conn, err = net.Dial(network, addr)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "sending to %s (%s)\n", conn.RemoteAddr(), network)
+	return p.stream(conn, newStdinReader())
+}
+
+// listenPacket writes datagrams received to stdout and sends
+// stdin to the sender of the most recent datagram.
+func listenPacket(network, addr string, p *pipe) error {
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if network == "unixgram" {
+		defer os.Remove(addr)
+	}
+	fmt.Fprintf(os.Stderr, "listening on %s (%s)\n", conn.LocalAddr(), network)
+
+	var mu sync.Mutex
+	var peer net.Addr
+	known := make(chan struct{})
+
+	// stdin -> last peer, once there is one, so that
+	// input is not read before it can be sent
+	go func() {
+		<-known
+		for data := range newStdinReader().ch {
+			mu.Lock()
+			to := peer
+			mu.Unlock()
+			if _, err := conn.WriteTo(data, to); err != nil {
+				fmt.Fprintln(os.Stderr, "gonc:", err)
+				continue
+			}
+			p.hexdump(">", data)
+		}
+	}()
+
+	// peer -> stdout
+	buf := make([]byte, 64*1024)
+	for {
+		if p.idle > 0 {
+			conn.SetReadDeadline(time.Now().Add(p.idle))
+		}
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return nil
+			}
+			return err
+		}
+		// unbound unixgram senders have no address to reply to
+		if from != nil {
+			mu.Lock()
+			if peer == nil {
+				close(known)
+			}
+			if peer == nil || peer.String() != from.String() {
+				fmt.Fprintf(os.Stderr, "datagram from %s\n", from)
+			}
+			peer = from
+			mu.Unlock()
+		}
+		p.hexdump("<", buf[:n])
+		if _, err := os.Stdout.Write(buf[:n]); err != nil {
+			return err
+		}
+	}
+}
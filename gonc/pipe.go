@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pipe copies data between a connection and stdin/stdout.
+type pipe struct {
+	idle   time.Duration // idle timeout, 0 for none
+	quit   time.Duration // delay to quit after stdin EOF, 0 to wait for the peer
+	linger time.Duration // time piped input may still be sent after the peer EOF
+	dump   bool          // hexdump traffic to stderr
+	mu     sync.Mutex    // serializes hexdumps
+}
+
+// stream pipes in to conn and conn to stdout until the peer
+// closes the connection, the idle timeout expires, or, with
+// quit set, quit after in is exhausted.  When in is exhausted
+// the write side of a stream connection is closed so the peer
+// sees EOF, while its responses are still read.
+func (p *pipe) stream(conn net.Conn, in *stdinReader) error {
+	p.touch(conn)
+
+	done := make(chan struct{}) // closed when stream returns
+	sent := make(chan struct{}) // closed when the sender returns
+	quit := make(chan struct{}) // closed when the quit delay expires
+	defer func() {
+		close(done)
+		conn.Close()
+		// wait for the sender so it is done with in
+		<-sent
+	}()
+
+	// stdin -> conn
+	go func() {
+		defer close(sent)
+		p.send(conn, in, done, quit)
+	}()
+
+	// conn -> stdout
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			p.touch(conn)
+			p.hexdump("<", buf[:n])
+			if _, err := os.Stdout.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			select {
+			case <-quit:
+				return nil
+			default:
+			}
+			if err == io.EOF {
+				// the peer is done sending, give piped input
+				// a moment to be sent, but do not wait on an
+				// interactive user or a slow pipe.
+				if !in.terminal && p.linger > 0 {
+					select {
+					case <-sent:
+					case <-time.After(p.linger):
+					}
+				}
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				fmt.Fprintln(os.Stderr, "idle timeout, closing connection")
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// send copies in to conn until in is exhausted or done is closed.
+// Input taken but not written when done is closed is handed
+// back to in, for the next connection in listen mode.  After in
+// is exhausted, conn is closed once the quit delay, if any, expires.
+func (p *pipe) send(conn net.Conn, in *stdinReader, done, quit chan struct{}) {
+	for {
+		data, ok := in.pending, true
+		in.pending = nil
+		if data == nil {
+			select {
+			case <-done:
+				return
+			case data, ok = <-in.ch:
+			}
+		}
+		if !ok {
+			closeWrite(conn)
+			if p.quit > 0 {
+				time.AfterFunc(p.quit, func() {
+					close(quit)
+					conn.Close()
+				})
+			}
+			return
+		}
+
+		p.touch(conn)
+		if _, err := conn.Write(data); err != nil {
+			select {
+			case <-done:
+				in.pending = data
+			default:
+				fmt.Fprintln(os.Stderr, "gonc:", err)
+			}
+			return
+		}
+		p.hexdump(">", data)
+	}
+}
+
+// touch pushes the deadline of conn back by the idle timeout.
+func (p *pipe) touch(conn net.Conn) {
+	if p.idle > 0 {
+		conn.SetDeadline(time.Now().Add(p.idle))
+	}
+}
+
+// closeWrite half-closes stream connections (TCP, TLS, and unix).
+// Datagram connections have no notion of EOF and are left open.
+func closeWrite(conn net.Conn) {
+	switch conn.LocalAddr().Network() {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return
+	}
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+}
+
+// hexdump writes data to stderr, in the format of hexdump -C,
+// with each line prefixed by the direction of the transfer.
+func (p *pipe) hexdump(dir string, data []byte) {
+	if !p.dump {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, line := range strings.SplitAfter(hex.Dump(data), "\n") {
+		if line != "" {
+			fmt.Fprint(os.Stderr, dir, " ", line)
+		}
+	}
+}
+
+// stdinReader reads stdin from a single goroutine so that
+// successive connections, in listen mode, can share it
+// without a pending read swallowing input.
+type stdinReader struct {
+	ch       chan []byte
+	pending  []byte // read from ch but not sent, see pipe.send
+	terminal bool   // stdin is a terminal rather than a pipe or file
+}
+
+func newStdinReader() *stdinReader {
+	r := &stdinReader{ch: make(chan []byte)}
+	if fi, err := os.Stdin.Stat(); err == nil {
+		r.terminal = fi.Mode()&os.ModeCharDevice != 0
+	}
+	go func() {
+		defer close(r.ch)
+		for {
+			buf := make([]byte, 64*1024)
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				r.ch <- buf[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return r
+}